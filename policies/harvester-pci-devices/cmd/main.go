@@ -4,16 +4,19 @@ import (
 	"context"
 
 	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-pci-devices/internal/core/logger"
+	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-pci-devices/internal/domain"
 	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-pci-devices/internal/inbound"
 	"github.com/wapc/wapc-guest-tinygo"
 )
 
 func main() {
 	ctx := logger.ContextWithLogger(context.Background())
+	validator := domain.NewNodePlacementValidator()
+	loader := domain.NewBindingsLoader()
 
 	wapc.RegisterFunctions(wapc.Functions{
 		"validate": func(payload []byte) ([]byte, error) {
-			return inbound.ValidateRequest(ctx, payload)
+			return inbound.ValidateRequest(ctx, payload, &validator, &loader)
 		},
 		"validate_settings": func(payload []byte) ([]byte, error) {
 			return inbound.ValidateSettings(ctx, payload)
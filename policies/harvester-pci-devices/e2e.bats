@@ -77,3 +77,56 @@
   [ "$(expr "$output" : '.*allowed.*false')" -ne 0 ]
   [ "$(expr "$output" : ".*PCI DEVICE 'tekton27a-000001010' is not allowed for namespace: 'default'.*")" -ne 0 ]
 }
+
+@test "accept because the vm has no node placement and the node placement is enforced" {
+  run kwctl run annotated-policy.wasm -r test_data/virtualmachine-gpu.json --settings-json '{"namespaceDeviceBindings": [{"namespace": "default", "device": "tekton27a-000001010"}], "enforceNodePlacement": true}' --allow-context-aware --replay-host-capabilities-interactions test_data/session-pci-node.yaml
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  # request accepted
+  [ "$status" -eq 0 ]
+  [ "$(expr "$output" : '.*allowed.*true')" -ne 0 ]
+}
+
+@test "reject because the vm is pinned to a node without the pci device" {
+  run kwctl run annotated-policy.wasm -r test_data/virtualmachine-gpu-node-selector.json --settings-json '{"namespaceDeviceBindings": [{"namespace": "default", "device": "tekton27a-000001010"}], "enforceNodePlacement": true}' --allow-context-aware --replay-host-capabilities-interactions test_data/session-pci-node.yaml
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  # request rejected
+  [ "$status" -eq 0 ]
+  [ "$(expr "$output" : '.*allowed.*false')" -ne 0 ]
+  [ "$(expr "$output" : ".*PCI DEVICE 'tekton27a-000001010' is on node 'tekton27a', which the VM node placement does not allow.*")" -ne 0 ]
+}
+
+@test "accept because the gpu is bound to the namespace in the configmap" {
+  run kwctl run annotated-policy.wasm -r test_data/virtualmachine-gpu.json --settings-json '{"bindingsConfigMap": {"namespace": "harvester-system", "name": "pci-bindings", "key": "bindings.json"}}' --allow-context-aware --replay-host-capabilities-interactions test_data/session-pci-configmap.yaml
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  # request accepted
+  [ "$status" -eq 0 ]
+  [ "$(expr "$output" : '.*allowed.*true')" -ne 0 ]
+}
+
+@test "reject because the configmap key does not exist" {
+  run kwctl run annotated-policy.wasm -r test_data/virtualmachine-gpu.json --settings-json '{"bindingsConfigMap": {"namespace": "harvester-system", "name": "pci-bindings", "key": "missing.json"}}' --allow-context-aware --replay-host-capabilities-interactions test_data/session-pci-configmap.yaml
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  # request rejected
+  [ "$status" -eq 0 ]
+  [ "$(expr "$output" : '.*allowed.*false')" -ne 0 ]
+  [ "$(expr "$output" : ".*cannot load bindings from ConfigMap 'harvester-system/pci-bindings'.*")" -ne 0 ]
+}
+
+@test "mutate because the gpu node is required" {
+  run kwctl run annotated-policy.wasm -r test_data/virtualmachine-gpu.json --settings-json '{"namespaceDeviceBindings": [{"namespace": "default", "device": "tekton27a-000001010"}], "mutateNodeAffinity": true, "deviceNodes": {"tekton27a-000001010": "tekton27a"}}' --allow-context-aware
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  # request accepted and mutated
+  [ "$status" -eq 0 ]
+  [ "$(expr "$output" : '.*allowed.*true')" -ne 0 ]
+  [ "$(expr "$output" : '.*patchType.*JSONPatch')" -ne 0 ]
+}
@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// RequireNode adds a required node affinity to a VM object, so that it can only be scheduled on a node.
+//
+// The VM is kept as a generic object, so that the fields that the policy doesn't model are not lost.
+// Node selector terms are ORed, so the node requirement is added to every existing term.
+// It returns false when every term already requires the node.
+func RequireNode(virtualMachine map[string]interface{}, nodeName string) (bool, error) {
+	templateSpec, err := nestedObject(virtualMachine, "spec", "template", "spec")
+	if err != nil {
+		return false, err
+	}
+
+	affinity, err := nestedObject(templateSpec, "affinity")
+	if err != nil {
+		return false, err
+	}
+
+	nodeAffinity, err := nestedObject(affinity, "nodeAffinity")
+	if err != nil {
+		return false, err
+	}
+
+	required := NodeSelector{}
+	if raw, ok := nodeAffinity["requiredDuringSchedulingIgnoredDuringExecution"]; ok {
+		required, err = toNodeSelector(raw)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	requirement := NodeSelectorRequirement{
+		Key:      nodeNameField,
+		Operator: "In",
+		Values:   []string{nodeName},
+	}
+
+	if len(required.NodeSelectorTerms) == 0 {
+		required.NodeSelectorTerms = []NodeSelectorTerm{{}}
+	}
+
+	changed := false
+	for i := range required.NodeSelectorTerms {
+		term := &required.NodeSelectorTerms[i]
+		if !term.requiresNode(nodeName) {
+			term.MatchFields = append(term.MatchFields, requirement)
+			changed = true
+		}
+	}
+
+	nodeAffinity["requiredDuringSchedulingIgnoredDuringExecution"] = required
+
+	return changed, nil
+}
+
+// requiresNode checks whether the term already pins the node by name.
+func (t *NodeSelectorTerm) requiresNode(nodeName string) bool {
+	return slices.ContainsFunc(t.MatchFields, func(field NodeSelectorRequirement) bool {
+		return field.Key == nodeNameField && field.Operator == "In" && slices.Equal(field.Values, []string{nodeName})
+	})
+}
+
+// nestedObject returns the object of a path, and creates the missing objects along the way.
+func nestedObject(object map[string]interface{}, path ...string) (map[string]interface{}, error) {
+	current := object
+	for _, key := range path {
+		value, ok := current[key]
+		if !ok || value == nil {
+			next := map[string]interface{}{}
+			current[key] = next
+			current = next
+			continue
+		}
+
+		next, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("'%s' is not an object", key)
+		}
+		current = next
+	}
+
+	return current, nil
+}
+
+func toNodeSelector(raw interface{}) (NodeSelector, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return NodeSelector{}, err
+	}
+
+	selector := NodeSelector{}
+	err = json.Unmarshal(data, &selector)
+	if err != nil {
+		return NodeSelector{}, errors.New("'requiredDuringSchedulingIgnoredDuringExecution' is not a node selector")
+	}
+
+	return selector, nil
+}
@@ -0,0 +1,74 @@
+package domain_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-pci-devices/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireNode(t *testing.T) {
+	tests := []struct {
+		name        string
+		object      string
+		changed     bool
+		expectError bool
+		expected    string
+	}{
+		{
+			name:     "VM without affinity",
+			object:   `{"spec":{"template":{"spec":{"domain":{}}}}}`,
+			changed:  true,
+			expected: `{"spec":{"template":{"spec":{"affinity":{"nodeAffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[{"matchFields":[{"key":"metadata.name","operator":"In","values":["tekton27a"]}]}]}}},"domain":{}}}}}`,
+		},
+		{
+			name:     "VM with affinity terms",
+			object:   `{"spec":{"template":{"spec":{"affinity":{"nodeAffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[{"matchExpressions":[{"key":"gpu","operator":"Exists"}]},{"matchExpressions":[{"key":"zone","operator":"In","values":["a"]}]}]}}}}}}}`,
+			changed:  true,
+			expected: `{"spec":{"template":{"spec":{"affinity":{"nodeAffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[{"matchExpressions":[{"key":"gpu","operator":"Exists"}],"matchFields":[{"key":"metadata.name","operator":"In","values":["tekton27a"]}]},{"matchExpressions":[{"key":"zone","operator":"In","values":["a"]}],"matchFields":[{"key":"metadata.name","operator":"In","values":["tekton27a"]}]}]}}}}}}}`,
+		},
+		{
+			name:     "VM with other affinities",
+			object:   `{"spec":{"template":{"spec":{"affinity":{"nodeAffinity":{"preferredDuringSchedulingIgnoredDuringExecution":[]},"podAntiAffinity":{}}}}}}`,
+			changed:  true,
+			expected: `{"spec":{"template":{"spec":{"affinity":{"nodeAffinity":{"preferredDuringSchedulingIgnoredDuringExecution":[],"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[{"matchFields":[{"key":"metadata.name","operator":"In","values":["tekton27a"]}]}]}},"podAntiAffinity":{}}}}}}`,
+		},
+		{
+			name:     "VM that already requires the node",
+			object:   `{"spec":{"template":{"spec":{"affinity":{"nodeAffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[{"matchFields":[{"key":"metadata.name","operator":"In","values":["tekton27a"]}]}]}}}}}}}`,
+			changed:  false,
+			expected: `{"spec":{"template":{"spec":{"affinity":{"nodeAffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[{"matchFields":[{"key":"metadata.name","operator":"In","values":["tekton27a"]}]}]}}}}}}}`,
+		},
+		{
+			name:        "VM with a bad affinity",
+			object:      `{"spec":{"template":{"spec":{"affinity":"tekton27a"}}}}`,
+			expectError: true,
+		},
+		{
+			name:        "VM with a bad node selector",
+			object:      `{"spec":{"template":{"spec":{"affinity":{"nodeAffinity":{"requiredDuringSchedulingIgnoredDuringExecution":[]}}}}}}`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object := map[string]interface{}{}
+			require.NoError(t, json.Unmarshal([]byte(tt.object), &object))
+
+			changed, err := domain.RequireNode(object, "tekton27a")
+			if tt.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.changed, changed)
+
+			result, err := json.Marshal(object)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(result))
+		})
+	}
+}
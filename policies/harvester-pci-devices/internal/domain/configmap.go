@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+)
+
+type ConfigMap struct {
+	Data map[string]string `json:"data"`
+}
+
+// BindingsLoader reads namespace device bindings from a ConfigMap.
+type BindingsLoader struct{}
+
+func NewBindingsLoader() BindingsLoader {
+	return BindingsLoader{}
+}
+
+// LoadBindings asks Kubernetes for the ConfigMap and parses the bindings stored under its key.
+//
+// The key holds a JSON list of bindings, for example:
+//
+//	[{"namespace": "namespace-01", "device": "tekton27a-000001010"}]
+func (l *BindingsLoader) LoadBindings(
+	_ context.Context,
+	host *capabilities.Host,
+	ref *ConfigMapReference,
+) ([]NamespaceDeviceBinding, error) {
+	kubeRequest := kubernetes.GetResourceRequest{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Name:       ref.Name,
+		Namespace:  &ref.Namespace,
+	}
+
+	response, err := kubernetes.GetResource(host, kubeRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	configMap := ConfigMap{}
+	err = json.Unmarshal(response, &configMap)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshall response into ConfigMap: %w", err)
+	}
+
+	data, ok := configMap.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("ConfigMap '%s/%s' has no key '%s'", ref.Namespace, ref.Name, ref.Key)
+	}
+
+	bindings := []NamespaceDeviceBinding{}
+	err = decodeStrict([]byte(data), &bindings)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse bindings of ConfigMap '%s/%s': %w", ref.Namespace, ref.Name, err)
+	}
+
+	return bindings, nil
+}
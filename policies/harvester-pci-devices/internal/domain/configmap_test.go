@@ -0,0 +1,81 @@
+package domain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-pci-devices/internal/domain"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindingsLoader_LoadBindings(t *testing.T) {
+	ctx := context.Background()
+	loader := domain.NewBindingsLoader()
+	ref := &domain.ConfigMapReference{
+		Namespace: "harvester-system",
+		Name:      "pci-bindings",
+		Key:       "bindings.json",
+	}
+	expectedInputPayload := `{"api_version":"v1","kind":"ConfigMap","name":"pci-bindings","namespace":"harvester-system","disable_cache":false}`
+
+	tt := []struct {
+		name          string
+		response      string
+		responseError error
+		bindings      []domain.NamespaceDeviceBinding
+		expectError   bool
+	}{
+		{
+			name:     "ConfigMap with bindings",
+			response: `{"apiVersion":"v1","kind":"ConfigMap","data":{"bindings.json":"[{\"namespace\":\"namespace-1\",\"device\":\"gpu-1\"}]"}}`,
+			bindings: []domain.NamespaceDeviceBinding{
+				{Namespace: "namespace-1", Device: "gpu-1"},
+			},
+		},
+		{
+			name:        "ConfigMap without the key",
+			response:    `{"apiVersion":"v1","kind":"ConfigMap","data":{"other.json":"[]"}}`,
+			expectError: true,
+		},
+		{
+			name:        "ConfigMap with bad bindings",
+			response:    `{"apiVersion":"v1","kind":"ConfigMap","data":{"bindings.json":"namespace-1: gpu-1"}}`,
+			expectError: true,
+		},
+		{
+			name:          "ConfigMap request failed",
+			responseError: assert.AnError,
+			expectError:   true,
+		},
+		{
+			name:        "ConfigMap request bad json",
+			response:    "foobar",
+			expectError: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			mockWapcClient := &mocks.MockWapcClient{}
+			mockWapcClient.
+				EXPECT().
+				HostCall("kubewarden", "kubernetes", "get_resource", []byte(expectedInputPayload)).
+				Return([]byte(tc.response), tc.responseError).
+				Times(1)
+
+			host := &capabilities.Host{
+				Client: mockWapcClient,
+			}
+
+			bindings, err := loader.LoadBindings(ctx, host, ref)
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.bindings, bindings)
+		})
+	}
+}
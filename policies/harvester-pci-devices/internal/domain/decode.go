@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// decodeStrict unmarshals JSON like json.Unmarshal, but fails on unknown fields and trailing data.
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = decoder.Token()
+	if !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after the JSON object")
+	}
+
+	return nil
+}
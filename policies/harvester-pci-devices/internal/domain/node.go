@@ -0,0 +1,21 @@
+package domain
+
+type NodeMetadata struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+}
+
+type Node struct {
+	Metadata NodeMetadata `json:"metadata"`
+}
+
+type PCIDeviceStatus struct {
+	NodeName string `json:"nodeName"`
+	Address  string `json:"address"`
+}
+
+// PCIDeviceResource is the Harvester `devices.harvesterhci.io/v1beta1` PCIDevice object.
+type PCIDeviceResource struct {
+	Metadata Metadata        `json:"metadata"`
+	Status   PCIDeviceStatus `json:"status"`
+}
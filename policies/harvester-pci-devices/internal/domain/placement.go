@@ -0,0 +1,204 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-pci-devices/internal/core/logger"
+	"github.com/francoispqt/onelog"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+)
+
+const (
+	pciDeviceAPIVersion = "devices.harvesterhci.io/v1beta1"
+	pciDeviceKind       = "PCIDevice"
+	nodeNameField       = "metadata.name"
+)
+
+// NodePlacementValidator validates that a VM's node placement can reach the node of its PCI devices.
+type NodePlacementValidator struct{}
+
+func NewNodePlacementValidator() NodePlacementValidator {
+	return NodePlacementValidator{}
+}
+
+// FindDeviceNode asks Kubernetes for the Harvester PCIDevice and returns the node it lives on.
+func (v *NodePlacementValidator) FindDeviceNode(
+	_ context.Context,
+	host *capabilities.Host,
+	device string,
+) (string, error) {
+	kubeRequest := kubernetes.GetResourceRequest{
+		APIVersion: pciDeviceAPIVersion,
+		Kind:       pciDeviceKind,
+		Name:       device,
+	}
+
+	response, err := kubernetes.GetResource(host, kubeRequest)
+	if err != nil {
+		return "", err
+	}
+
+	pciDevice := PCIDeviceResource{}
+	err = json.Unmarshal(response, &pciDevice)
+	if err != nil {
+		return "", fmt.Errorf("cannot unmarshall response into PCIDevice: %w", err)
+	}
+
+	if pciDevice.Status.NodeName == "" {
+		return "", fmt.Errorf("PCIDevice '%s' does not report a node", device)
+	}
+
+	return pciDevice.Status.NodeName, nil
+}
+
+// IsNodeAllowed verifies if a VM's node placement allows it to be scheduled on a node.
+//
+// Restrictions
+//   - every nodeSelector label must be set on the node with the same value
+//   - if a required node affinity is set, at least one of its terms must match the node
+//   - a VM without a nodeSelector or a required node affinity can be scheduled anywhere
+func (v *NodePlacementValidator) IsNodeAllowed(
+	ctx context.Context,
+	host *capabilities.Host,
+	nodeName string,
+	spec *VirtualMachineTemplateSpec,
+) (bool, error) {
+	if len(spec.NodeSelector) == 0 && spec.requiredNodeSelector() == nil {
+		return true, nil
+	}
+
+	node, err := v.findNode(host, nodeName)
+	if err != nil {
+		return false, err
+	}
+
+	allowed := spec.AllowsNode(&node)
+	logger.FromContext(ctx).DebugWithFields("node placement checked", func(entry onelog.Entry) {
+		entry.String("node", nodeName)
+		entry.Bool("allowed", allowed)
+	})
+
+	return allowed, nil
+}
+
+// findNode asks Kubernetes for the Node, which is needed to match its labels.
+func (v *NodePlacementValidator) findNode(host *capabilities.Host, nodeName string) (Node, error) {
+	kubeRequest := kubernetes.GetResourceRequest{
+		APIVersion: "v1",
+		Kind:       "Node",
+		Name:       nodeName,
+	}
+
+	response, err := kubernetes.GetResource(host, kubeRequest)
+	if err != nil {
+		return Node{}, err
+	}
+
+	node := Node{}
+	err = json.Unmarshal(response, &node)
+	if err != nil {
+		return Node{}, fmt.Errorf("cannot unmarshall response into Node: %w", err)
+	}
+
+	return node, nil
+}
+
+// AllowsNode checks whether the nodeSelector and the required node affinity both match the node.
+func (s *VirtualMachineTemplateSpec) AllowsNode(node *Node) bool {
+	for key, value := range s.NodeSelector {
+		if nodeValue, ok := node.Metadata.Labels[key]; !ok || nodeValue != value {
+			return false
+		}
+	}
+
+	required := s.requiredNodeSelector()
+	if required == nil {
+		return true
+	}
+
+	// node selector terms are ORed
+	for _, term := range required.NodeSelectorTerms {
+		if term.matches(node) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *VirtualMachineTemplateSpec) requiredNodeSelector() *NodeSelector {
+	if s.Affinity == nil || s.Affinity.NodeAffinity == nil {
+		return nil
+	}
+
+	return s.Affinity.NodeAffinity.RequiredDuringScheduling
+}
+
+// matches checks a single node selector term, its requirements are ANDed.
+// An empty term matches no node, like in Kubernetes.
+func (t *NodeSelectorTerm) matches(node *Node) bool {
+	if len(t.MatchExpressions) == 0 && len(t.MatchFields) == 0 {
+		return false
+	}
+
+	for _, expression := range t.MatchExpressions {
+		value, ok := node.Metadata.Labels[expression.Key]
+		if !expression.matches(value, ok) {
+			return false
+		}
+	}
+
+	for _, field := range t.MatchFields {
+		// metadata.name is the only field supported by Kubernetes
+		if field.Key != nodeNameField || !field.matches(node.Metadata.Name, true) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *NodeSelectorRequirement) matches(value string, exists bool) bool {
+	switch r.Operator {
+	case "In":
+		return exists && slices.Contains(r.Values, value)
+	case "NotIn":
+		return !exists || !slices.Contains(r.Values, value)
+	case "Exists":
+		return exists
+	case "DoesNotExist":
+		return !exists
+	case "Gt", "Lt":
+		return exists && r.compare(value)
+	default:
+		return false
+	}
+}
+
+// compare implements the Gt and Lt operators, which expect a single integer value.
+func (r *NodeSelectorRequirement) compare(value string) bool {
+	if len(r.Values) != 1 {
+		return false
+	}
+
+	nodeValue, err := strconv.Atoi(value)
+	if err != nil {
+		return false
+	}
+
+	requirement, err := strconv.Atoi(r.Values[0])
+	if err != nil {
+		return false
+	}
+
+	if r.Operator == "Gt" {
+		return nodeValue > requirement
+	}
+
+	return nodeValue < requirement
+}
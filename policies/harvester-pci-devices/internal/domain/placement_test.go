@@ -0,0 +1,202 @@
+package domain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-pci-devices/internal/domain"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodePlacementValidator_FindDeviceNode(t *testing.T) {
+	ctx := context.Background()
+	validator := domain.NewNodePlacementValidator()
+	expectedInputPayload := `{"api_version":"devices.harvesterhci.io/v1beta1","kind":"PCIDevice","name":"tekton27a-000001010","disable_cache":false}`
+
+	tt := []struct {
+		name          string
+		response      string
+		responseError error
+		nodeName      string
+		expectError   bool
+	}{
+		{
+			name:     "PCIDevice with a node",
+			response: `{"apiVersion":"devices.harvesterhci.io/v1beta1","kind":"PCIDevice","metadata":{"name":"tekton27a-000001010"},"status":{"address":"0000:01:01.0","nodeName":"tekton27a"}}`,
+			nodeName: "tekton27a",
+		},
+		{
+			name:        "PCIDevice without a node",
+			response:    `{"apiVersion":"devices.harvesterhci.io/v1beta1","kind":"PCIDevice","metadata":{"name":"tekton27a-000001010"}}`,
+			expectError: true,
+		},
+		{
+			name:          "PCIDevice request failed",
+			responseError: assert.AnError,
+			expectError:   true,
+		},
+		{
+			name:        "PCIDevice request bad json",
+			response:    "foobar",
+			expectError: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			mockWapcClient := &mocks.MockWapcClient{}
+			mockWapcClient.
+				EXPECT().
+				HostCall("kubewarden", "kubernetes", "get_resource", []byte(expectedInputPayload)).
+				Return([]byte(tc.response), tc.responseError).
+				Times(1)
+
+			host := &capabilities.Host{
+				Client: mockWapcClient,
+			}
+
+			nodeName, err := validator.FindDeviceNode(ctx, host, "tekton27a-000001010")
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.nodeName, nodeName)
+		})
+	}
+}
+
+func TestNodePlacementValidator_IsNodeAllowed(t *testing.T) {
+	ctx := context.Background()
+	validator := domain.NewNodePlacementValidator()
+	expectedInputPayload := `{"api_version":"v1","kind":"Node","name":"tekton27a","disable_cache":false}`
+	nodeResponse := `{"apiVersion":"v1","kind":"Node","metadata":{"name":"tekton27a","labels":{"kubernetes.io/hostname":"tekton27a","gpu":"true","gpu-count":"4"}}}`
+
+	tt := []struct {
+		name          string
+		spec          domain.VirtualMachineTemplateSpec
+		response      string
+		responseError error
+		result        bool
+		expectError   bool
+		expectCall    bool
+	}{
+		{
+			name:   "Allowed: no node placement",
+			spec:   domain.VirtualMachineTemplateSpec{},
+			result: true,
+		},
+		{
+			name: "Allowed: nodeSelector matches the node",
+			spec: domain.VirtualMachineTemplateSpec{
+				NodeSelector: map[string]string{"kubernetes.io/hostname": "tekton27a"},
+			},
+			response:   nodeResponse,
+			result:     true,
+			expectCall: true,
+		},
+		{
+			name: "Denied: nodeSelector pins another node",
+			spec: domain.VirtualMachineTemplateSpec{
+				NodeSelector: map[string]string{"kubernetes.io/hostname": "tekton27b"},
+			},
+			response:   nodeResponse,
+			result:     false,
+			expectCall: true,
+		},
+		{
+			name: "Allowed: one of the affinity terms matches the node",
+			spec: specWithAffinity(
+				domain.NodeSelectorTerm{
+					MatchFields: []domain.NodeSelectorRequirement{
+						{Key: "metadata.name", Operator: "In", Values: []string{"tekton27b"}},
+					},
+				},
+				domain.NodeSelectorTerm{
+					MatchExpressions: []domain.NodeSelectorRequirement{
+						{Key: "gpu", Operator: "Exists"},
+						{Key: "gpu-count", Operator: "Gt", Values: []string{"2"}},
+					},
+				},
+			),
+			response:   nodeResponse,
+			result:     true,
+			expectCall: true,
+		},
+		{
+			name: "Denied: no affinity term matches the node",
+			spec: specWithAffinity(
+				domain.NodeSelectorTerm{
+					MatchExpressions: []domain.NodeSelectorRequirement{
+						{Key: "kubernetes.io/hostname", Operator: "NotIn", Values: []string{"tekton27a"}},
+					},
+				},
+				domain.NodeSelectorTerm{
+					MatchExpressions: []domain.NodeSelectorRequirement{
+						{Key: "gpu", Operator: "DoesNotExist"},
+					},
+				},
+			),
+			response:   nodeResponse,
+			result:     false,
+			expectCall: true,
+		},
+		{
+			name: "Denied: empty affinity term",
+			spec: specWithAffinity(
+				domain.NodeSelectorTerm{},
+			),
+			response:   nodeResponse,
+			result:     false,
+			expectCall: true,
+		},
+		{
+			name: "Error: Node request failed",
+			spec: domain.VirtualMachineTemplateSpec{
+				NodeSelector: map[string]string{"kubernetes.io/hostname": "tekton27a"},
+			},
+			responseError: assert.AnError,
+			expectError:   true,
+			expectCall:    true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			mockWapcClient := &mocks.MockWapcClient{}
+			if tc.expectCall {
+				mockWapcClient.
+					EXPECT().
+					HostCall("kubewarden", "kubernetes", "get_resource", []byte(expectedInputPayload)).
+					Return([]byte(tc.response), tc.responseError).
+					Times(1)
+			}
+
+			host := &capabilities.Host{
+				Client: mockWapcClient,
+			}
+
+			result, err := validator.IsNodeAllowed(ctx, host, "tekton27a", &tc.spec)
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.result, result)
+			mockWapcClient.AssertExpectations(t)
+		})
+	}
+}
+
+func specWithAffinity(terms ...domain.NodeSelectorTerm) domain.VirtualMachineTemplateSpec {
+	return domain.VirtualMachineTemplateSpec{
+		Affinity: &domain.Affinity{
+			NodeAffinity: &domain.NodeAffinity{
+				RequiredDuringScheduling: &domain.NodeSelector{
+					NodeSelectorTerms: terms,
+				},
+			},
+		},
+	}
+}
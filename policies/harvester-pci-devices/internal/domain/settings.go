@@ -2,7 +2,9 @@ package domain
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-pci-devices/internal/core/logger"
 	"github.com/francoispqt/onelog"
@@ -14,41 +16,222 @@ type NamespaceDeviceBinding struct {
 	Device    string `json:"device"`
 }
 
+// ConfigMapReference points to the key of a ConfigMap holding namespace device bindings.
+type ConfigMapReference struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Key       string `json:"key"`
+}
+
+func (r *ConfigMapReference) String() string {
+	return fmt.Sprintf("ConfigMap '%s/%s' key '%s'", r.Namespace, r.Name, r.Key)
+}
+
+// FailurePolicy decides what happens when the bindings of a ConfigMap cannot be loaded.
+type FailurePolicy string
+
+const (
+	// FailurePolicyFail rejects the request.
+	FailurePolicyFail FailurePolicy = "Fail"
+	// FailurePolicyIgnore validates the request with the inline bindings only.
+	FailurePolicyIgnore FailurePolicy = "Ignore"
+)
+
+// BindingMode decides how namespaces and pci devices without a binding together are treated.
+type BindingMode string
+
+const (
+	// BindingModeStrict denies every unbound pair, it's the default.
+	BindingModeStrict BindingMode = "strict"
+	// BindingModeExclusive locks bound devices to their namespaces and leaves unbound devices free.
+	BindingModeExclusive BindingMode = "exclusive"
+	// BindingModeNamespaceOnly restricts only the namespaces with bindings.
+	BindingModeNamespaceOnly BindingMode = "namespaceOnly"
+)
+
 // Settings is the structure that describes the policy settings.
 type Settings struct {
 	NamespaceDeviceBindings []NamespaceDeviceBinding `json:"namespaceDeviceBindings"`
+	// Mode defaults to strict.
+	Mode BindingMode `json:"mode,omitempty"`
+	// EnforceNodePlacement rejects VMs whose node placement cannot reach the node of their PCI devices.
+	EnforceNodePlacement bool `json:"enforceNodePlacement"`
+	// BindingsConfigMap is an optional ConfigMap whose bindings are merged with NamespaceDeviceBindings.
+	BindingsConfigMap *ConfigMapReference `json:"bindingsConfigMap,omitempty"`
+	// ConfigMapFailurePolicy defaults to Fail.
+	ConfigMapFailurePolicy FailurePolicy `json:"configMapFailurePolicy,omitempty"`
+	// MutateNodeAffinity requires VMs to run on the node of their PCI devices.
+	MutateNodeAffinity bool `json:"mutateNodeAffinity"`
+	// DeviceNodes maps PCI devices to their node, instead of looking up the PCIDevice objects.
+	DeviceNodes map[string]string `json:"deviceNodes,omitempty"`
+}
+
+// SettingsError lists every problem found in the settings.
+type SettingsError struct {
+	Problems []string
+}
+
+func (e *SettingsError) Error() string {
+	return strings.Join(e.Problems, "; ")
 }
 
 func NewSettingsFromValidationReq(validationReq *kubewardenProtocol.ValidationRequest) (Settings, error) {
+	return NewSettingsFromJSON(validationReq.Settings)
+}
+
+// NewSettingsFromJSON decodes the settings with decodeStrict.
+func NewSettingsFromJSON(payload []byte) (Settings, error) {
 	settings := Settings{}
-	err := json.Unmarshal(validationReq.Settings, &settings)
+	err := decodeStrict(payload, &settings)
 	return settings, err
 }
 
-func (s *Settings) Valid(ctx context.Context) bool {
-	l := logger.FromContext(ctx)
+// Validate verifies the settings, and returns a SettingsError with every problem it found.
+func (s *Settings) Validate() error {
+	problems := s.modeProblems()
+	problems = append(problems, s.bindingProblems()...)
+	problems = append(problems, s.configMapProblems()...)
+	problems = append(problems, s.deviceNodeProblems()...)
 
-	for _, binding := range s.NamespaceDeviceBindings {
-		// Check if namespace and device are not empty
+	if len(problems) > 0 {
+		return &SettingsError{Problems: problems}
+	}
+
+	return nil
+}
+
+// modeProblems ensures that the binding mode is known.
+func (s *Settings) modeProblems() []string {
+	switch s.Mode {
+	case "", BindingModeStrict, BindingModeExclusive, BindingModeNamespaceOnly:
+		return []string{}
+	default:
+		return []string{fmt.Sprintf(
+			"mode: unknown mode '%s', expected '%s', '%s' or '%s'",
+			s.Mode, BindingModeStrict, BindingModeExclusive, BindingModeNamespaceOnly)}
+	}
+}
+
+// bindingProblems ensures that every binding is complete and bound only once.
+func (s *Settings) bindingProblems() []string {
+	seen := map[NamespaceDeviceBinding]string{}
+	return bindingListProblems("namespaceDeviceBindings", s.NamespaceDeviceBindings, seen)
+}
+
+// bindingListProblems checks a list of bindings named source, seen holds the bindings of the previous lists.
+func bindingListProblems(
+	source string,
+	bindings []NamespaceDeviceBinding,
+	seen map[NamespaceDeviceBinding]string,
+) []string {
+	problems := []string{}
+
+	for i, binding := range bindings {
+		entry := fmt.Sprintf("%s[%d]", source, i)
 		if binding.Namespace == "" || binding.Device == "" {
-			l.InfoWithFields("invalid settings, namespace and device must be specified", func(entry onelog.Entry) {
-				entry.String("namespace", binding.Namespace)
-				entry.String("device", binding.Device)
-			})
+			problems = append(problems, entry+": namespace and device must be specified")
+			continue
+		}
+
+		if first, ok := seen[binding]; ok {
+			problems = append(problems, fmt.Sprintf("%s: duplicate of %s", entry, first))
+			continue
+		}
+		seen[binding] = entry
+	}
+
+	return problems
+}
 
-			return false
+// configMapProblems ensures that a ConfigMap reference is complete and that the failure policy is known.
+func (s *Settings) configMapProblems() []string {
+	problems := []string{}
+
+	switch s.ConfigMapFailurePolicy {
+	case "", FailurePolicyFail, FailurePolicyIgnore:
+	default:
+		problems = append(problems, fmt.Sprintf(
+			"configMapFailurePolicy: unknown policy '%s', expected '%s' or '%s'",
+			s.ConfigMapFailurePolicy, FailurePolicyFail, FailurePolicyIgnore))
+	}
+
+	ref := s.BindingsConfigMap
+	if ref == nil {
+		if s.ConfigMapFailurePolicy != "" {
+			problems = append(problems, "configMapFailurePolicy: requires bindingsConfigMap")
 		}
+		return problems
+	}
+
+	if ref.Namespace == "" || ref.Name == "" || ref.Key == "" {
+		problems = append(problems, "bindingsConfigMap: namespace, name and key must be specified")
 	}
 
-	return true
+	return problems
+}
+
+// deviceNodeProblems ensures that every static device node is complete and used.
+func (s *Settings) deviceNodeProblems() []string {
+	problems := []string{}
+
+	if len(s.DeviceNodes) > 0 && !s.MutateNodeAffinity {
+		problems = append(problems, "deviceNodes: requires mutateNodeAffinity")
+	}
+
+	devices := make([]string, 0, len(s.DeviceNodes))
+	for device := range s.DeviceNodes {
+		devices = append(devices, device)
+	}
+	slices.Sort(devices)
+
+	for _, device := range devices {
+		if device == "" || s.DeviceNodes[device] == "" {
+			problems = append(problems, fmt.Sprintf("deviceNodes[%s]: device and node must be specified", device))
+		}
+	}
+
+	return problems
+}
+
+// WithBindings returns a copy of the settings with additional namespace device bindings.
+// The bindings are checked with the same rules as the inline ones, and their problems are named after source.
+func (s *Settings) WithBindings(source string, bindings []NamespaceDeviceBinding) (Settings, error) {
+	seen := map[NamespaceDeviceBinding]string{}
+	bindingListProblems("namespaceDeviceBindings", s.NamespaceDeviceBindings, seen)
+
+	problems := bindingListProblems(source, bindings, seen)
+	if len(problems) > 0 {
+		return Settings{}, &SettingsError{Problems: problems}
+	}
+
+	merged := *s
+	merged.NamespaceDeviceBindings = append(
+		slices.Clone(s.NamespaceDeviceBindings),
+		bindings...,
+	)
+
+	return merged, nil
+}
+
+// IgnoreConfigMapFailures tells whether the inline bindings are enough when the ConfigMap cannot be loaded.
+func (s *Settings) IgnoreConfigMapFailures() bool {
+	return s.ConfigMapFailurePolicy == FailurePolicyIgnore
+}
+
+// DeviceNode returns the node of a PCI device from the static deviceNodes map.
+func (s *Settings) DeviceNode(device string) (string, bool) {
+	node, ok := s.DeviceNodes[device]
+	return node, ok
 }
 
 // IsGPUAllowed verifies if a (namespace, device) combination is allowed.
 //
-// Restrictions
-//   - namespaces with pci device bindings can only accept a pci device bound to it
-//   - pci devices with namespace bindings can only accept a namespace bound to it
-//   - If a namespace and a pci device don't have a binding, then it's restricted
+// A bound (namespace, device) pair is always allowed. The binding mode decides the other pairs:
+//   - strict: a namespace and a pci device without a binding together are restricted
+//   - exclusive: pci devices with namespace bindings can only accept a namespace bound to them,
+//     unbound pci devices are unrestricted
+//   - namespaceOnly: namespaces with pci device bindings can only accept a pci device bound to them,
+//     unbound namespaces are unrestricted
 //
 // example:
 //
@@ -56,29 +239,48 @@ func (s *Settings) Valid(ctx context.Context) bool {
 //			- namespace: namespace-01
 //			  device: tekton27a-000001010
 //
-// Allowed:
+// Truth table:
 //
-//	{"namespace": "namespace-01", "device": "tekton27a-000001010"}
-//
-// Denied:
-//
-//	{"namespace": "namespace-02", "device": "tekton27a-000001010"}
-//	{"namespace": "random-namespace", "device": "tekton28a-000001010"}
+//	namespace         device                strict  exclusive  namespaceOnly
+//	namespace-01      tekton27a-000001010   allow   allow      allow
+//	namespace-01      tekton28a-000001010   deny    allow      deny
+//	random-namespace  tekton27a-000001010   deny    deny       allow
+//	random-namespace  tekton28a-000001010   deny    allow      allow
 func (s *Settings) IsGPUAllowed(ctx context.Context, namespace, device string) bool {
 	l := logger.FromContext(ctx).With(func(entry onelog.Entry) {
 		entry.String("namespace", namespace)
 		entry.String("device", device)
+		entry.String("mode", string(s.Mode))
 	})
 
+	namespaceBound := false
+	deviceBound := false
+
 	for _, ns := range s.NamespaceDeviceBindings {
 		// device and namespace are bound
 		if ns.Device == device && ns.Namespace == namespace {
 			l.Debug("device and namespace matched")
 			return true
 		}
+
+		namespaceBound = namespaceBound || ns.Namespace == namespace
+		deviceBound = deviceBound || ns.Device == device
+	}
+
+	allowed := false
+	switch s.Mode {
+	case BindingModeExclusive:
+		allowed = !deviceBound
+	case BindingModeNamespaceOnly:
+		allowed = !namespaceBound
+	case BindingModeStrict, "":
+	}
+
+	if allowed {
+		l.Debug("device and namespace are unrestricted")
+		return true
 	}
 
-	// if allowed is "true", it's because the namespace and device are not bound and are considered unrestricted
 	l.Debug("Device is restricted")
 	return false
 }
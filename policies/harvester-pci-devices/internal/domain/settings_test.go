@@ -14,8 +14,6 @@ import (
 )
 
 func TestSettings_Valid(t *testing.T) {
-	ctx := context.Background()
-
 	tt := []struct {
 		name         string
 		settings     domain.Settings
@@ -58,13 +56,63 @@ func TestSettings_Valid(t *testing.T) {
 			},
 			expectResult: false,
 		},
+		{
+			name: "Valid settings with a ConfigMap",
+			settings: domain.Settings{
+				BindingsConfigMap: &domain.ConfigMapReference{
+					Namespace: "harvester-system",
+					Name:      "pci-bindings",
+					Key:       "bindings.json",
+				},
+				ConfigMapFailurePolicy: domain.FailurePolicyIgnore,
+			},
+			expectResult: true,
+		},
+		{
+			name: "Invalid settings with a ConfigMap without key",
+			settings: domain.Settings{
+				BindingsConfigMap: &domain.ConfigMapReference{
+					Namespace: "harvester-system",
+					Name:      "pci-bindings",
+				},
+			},
+			expectResult: false,
+		},
+		{
+			name: "Invalid settings with a device without node",
+			settings: domain.Settings{
+				DeviceNodes: map[string]string{"device-1": ""},
+			},
+			expectResult: false,
+		},
+		{
+			name: "Valid settings with a binding mode",
+			settings: domain.Settings{
+				Mode: domain.BindingModeNamespaceOnly,
+			},
+			expectResult: true,
+		},
+		{
+			name: "Invalid settings with an unknown binding mode",
+			settings: domain.Settings{
+				Mode: "open",
+			},
+			expectResult: false,
+		},
+		{
+			name: "Invalid settings with an unknown failure policy",
+			settings: domain.Settings{
+				ConfigMapFailurePolicy: "Retry",
+			},
+			expectResult: false,
+		},
 	}
 
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
-			result := tc.settings.Valid(ctx)
+			err := tc.settings.Validate()
 
-			assert.Equal(t, tc.expectResult, result)
+			assert.Equal(t, tc.expectResult, err == nil)
 		})
 	}
 }
@@ -137,6 +185,173 @@ func TestSettings_IsGPUAllowed(t *testing.T) {
 	}
 }
 
+func TestSettings_Validate(t *testing.T) {
+	tt := []struct {
+		name     string
+		settings domain.Settings
+		problems []string
+	}{
+		{
+			name: "Valid settings",
+			settings: domain.Settings{
+				NamespaceDeviceBindings: []domain.NamespaceDeviceBinding{
+					{Namespace: "namespace1", Device: "device-1"},
+					{Namespace: "namespace2", Device: "device-1"},
+				},
+				MutateNodeAffinity: true,
+				DeviceNodes:        map[string]string{"device-1": "node-1"},
+			},
+		},
+		{
+			name: "Duplicate bindings",
+			settings: domain.Settings{
+				NamespaceDeviceBindings: []domain.NamespaceDeviceBinding{
+					{Namespace: "namespace1", Device: "device-1"},
+					{Namespace: "namespace2", Device: "device-2"},
+					{Namespace: "namespace1", Device: "device-1"},
+					{Namespace: "namespace2", Device: "device-2"},
+				},
+			},
+			problems: []string{
+				"namespaceDeviceBindings[2]: duplicate of namespaceDeviceBindings[0]",
+				"namespaceDeviceBindings[3]: duplicate of namespaceDeviceBindings[1]",
+			},
+		},
+		{
+			name: "Conflicting settings",
+			settings: domain.Settings{
+				ConfigMapFailurePolicy: domain.FailurePolicyIgnore,
+				DeviceNodes:            map[string]string{"device-2": "", "device-1": ""},
+			},
+			problems: []string{
+				"configMapFailurePolicy: requires bindingsConfigMap",
+				"deviceNodes: requires mutateNodeAffinity",
+				"deviceNodes[device-1]: device and node must be specified",
+				"deviceNodes[device-2]: device and node must be specified",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.settings.Validate()
+			if tc.problems == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			var settingsError *domain.SettingsError
+			require.ErrorAs(t, err, &settingsError)
+			assert.Equal(t, tc.problems, settingsError.Problems)
+		})
+	}
+}
+
+func TestSettings_WithBindings(t *testing.T) {
+	ctx := context.Background()
+	settings := domain.Settings{
+		NamespaceDeviceBindings: []domain.NamespaceDeviceBinding{
+			{Namespace: "namespace1", Device: "device-1"},
+		},
+	}
+
+	merged, err := settings.WithBindings("bindings", []domain.NamespaceDeviceBinding{
+		{Namespace: "namespace2", Device: "device-2"},
+	})
+	require.NoError(t, err)
+	assert.Len(t, merged.NamespaceDeviceBindings, 2)
+	assert.Len(t, settings.NamespaceDeviceBindings, 1)
+	assert.True(t, merged.IsGPUAllowed(ctx, "namespace2", "device-2"))
+
+	_, err = settings.WithBindings("bindings", []domain.NamespaceDeviceBinding{
+		{Namespace: "namespace2"},
+		{Namespace: "namespace1", Device: "device-1"},
+	})
+	require.EqualError(t, err, "bindings[0]: namespace and device must be specified; "+
+		"bindings[1]: duplicate of namespaceDeviceBindings[0]")
+}
+
+func TestSettings_IsGPUAllowed_Modes(t *testing.T) {
+	ctx := context.Background()
+	bindings := []domain.NamespaceDeviceBinding{
+		{Namespace: "namespace-01", Device: "tekton27a-000001010"},
+		{Namespace: "namespace-02", Device: "tekton27b-000001010"},
+	}
+
+	tests := []struct {
+		name          string
+		namespace     string
+		device        string
+		strict        bool
+		exclusive     bool
+		namespaceOnly bool
+	}{
+		{
+			name:          "bound namespace with its device",
+			namespace:     "namespace-01",
+			device:        "tekton27a-000001010",
+			strict:        true,
+			exclusive:     true,
+			namespaceOnly: true,
+		},
+		{
+			name:          "bound namespace with another namespace's device",
+			namespace:     "namespace-01",
+			device:        "tekton27b-000001010",
+			strict:        false,
+			exclusive:     false,
+			namespaceOnly: false,
+		},
+		{
+			name:          "bound namespace with an unbound device",
+			namespace:     "namespace-01",
+			device:        "tekton28a-000001010",
+			strict:        false,
+			exclusive:     true,
+			namespaceOnly: false,
+		},
+		{
+			name:          "unbound namespace with a bound device",
+			namespace:     "random-namespace",
+			device:        "tekton27a-000001010",
+			strict:        false,
+			exclusive:     false,
+			namespaceOnly: true,
+		},
+		{
+			name:          "unbound namespace with an unbound device",
+			namespace:     "random-namespace",
+			device:        "tekton28a-000001010",
+			strict:        false,
+			exclusive:     true,
+			namespaceOnly: true,
+		},
+	}
+
+	modes := []struct {
+		mode   domain.BindingMode
+		result func(int) bool
+	}{
+		{mode: "", result: func(i int) bool { return tests[i].strict }},
+		{mode: domain.BindingModeStrict, result: func(i int) bool { return tests[i].strict }},
+		{mode: domain.BindingModeExclusive, result: func(i int) bool { return tests[i].exclusive }},
+		{mode: domain.BindingModeNamespaceOnly, result: func(i int) bool { return tests[i].namespaceOnly }},
+	}
+
+	for _, m := range modes {
+		settings := domain.Settings{
+			NamespaceDeviceBindings: bindings,
+			Mode:                    m.mode,
+		}
+		for i, tt := range tests {
+			t.Run(string(m.mode)+": "+tt.name, func(t *testing.T) {
+				result := settings.IsGPUAllowed(ctx, tt.namespace, tt.device)
+				assert.Equal(t, m.result(i), result)
+			})
+		}
+	}
+}
+
 func TestNewSettingsFromValidationReq(t *testing.T) {
 	settingsJSON := []byte(`{
 		"namespaceDeviceBindings": [
@@ -154,4 +369,12 @@ func TestNewSettingsFromValidationReq(t *testing.T) {
 	newSettings, err := domain.NewSettingsFromValidationReq(validationRequest)
 	require.NoError(t, err)
 	assert.Equal(t, "test-restricted-namespace-1", newSettings.NamespaceDeviceBindings[0].Namespace)
+
+	validationRequest.Settings = []byte(`{"namespaceDeviceindings": []}`)
+	_, err = domain.NewSettingsFromValidationReq(validationRequest)
+	require.EqualError(t, err, `json: unknown field "namespaceDeviceindings"`)
+
+	validationRequest.Settings = []byte(`{"namespaceDeviceBindings": []}}`)
+	_, err = domain.NewSettingsFromValidationReq(validationRequest)
+	require.EqualError(t, err, "unexpected data after the JSON object")
 }
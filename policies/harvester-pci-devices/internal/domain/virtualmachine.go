@@ -1,5 +1,7 @@
 package domain
 
+import "slices"
+
 type Metadata struct {
 	Namespace string `json:"namespace"`
 	Name      string `json:"name"`
@@ -19,8 +21,34 @@ type Domain struct {
 	Devices Devices `json:"devices"`
 }
 
+type NodeSelectorRequirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values,omitempty"`
+}
+
+type NodeSelectorTerm struct {
+	MatchExpressions []NodeSelectorRequirement `json:"matchExpressions,omitempty"`
+	MatchFields      []NodeSelectorRequirement `json:"matchFields,omitempty"`
+}
+
+type NodeSelector struct {
+	NodeSelectorTerms []NodeSelectorTerm `json:"nodeSelectorTerms"`
+}
+
+type NodeAffinity struct {
+	// RequiredDuringScheduling is requiredDuringSchedulingIgnoredDuringExecution.
+	RequiredDuringScheduling *NodeSelector `json:"requiredDuringSchedulingIgnoredDuringExecution,omitempty"`
+}
+
+type Affinity struct {
+	NodeAffinity *NodeAffinity `json:"nodeAffinity,omitempty"`
+}
+
 type VirtualMachineTemplateSpec struct {
-	Domain Domain `json:"domain"`
+	Domain       Domain            `json:"domain"`
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	Affinity     *Affinity         `json:"affinity,omitempty"`
 }
 
 type VirtualMachineSpecTemplate struct {
@@ -35,3 +63,9 @@ type VirtualMachine struct {
 	Metadata Metadata           `json:"metadata"`
 	Spec     VirtualMachineSpec `json:"spec"`
 }
+
+// PCIDevices returns both the GPUs and the host devices of the VM.
+func (vm *VirtualMachine) PCIDevices() []PCIDevice {
+	devices := vm.Spec.Template.Spec.Domain.Devices
+	return slices.Concat(devices.GPUS, devices.HostDevices)
+}
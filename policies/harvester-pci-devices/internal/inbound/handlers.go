@@ -0,0 +1,26 @@
+package inbound
+
+import (
+	"context"
+
+	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-pci-devices/internal/domain"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+)
+
+type nodePlacementValidator interface {
+	FindDeviceNode(ctx context.Context, host *capabilities.Host, device string) (string, error)
+	IsNodeAllowed(
+		ctx context.Context,
+		host *capabilities.Host,
+		nodeName string,
+		spec *domain.VirtualMachineTemplateSpec,
+	) (bool, error)
+}
+
+type bindingsLoader interface {
+	LoadBindings(
+		ctx context.Context,
+		host *capabilities.Host,
+		ref *domain.ConfigMapReference,
+	) ([]domain.NamespaceDeviceBinding, error)
+}
@@ -0,0 +1,49 @@
+package inbound_test
+
+import (
+	"context"
+
+	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-pci-devices/internal/domain"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockNodePlacementValidator struct {
+	mock.Mock
+}
+
+func (m *mockNodePlacementValidator) FindDeviceNode(
+	ctx context.Context,
+	host *capabilities.Host,
+	device string,
+) (string, error) {
+	args := m.Called(ctx, host, device)
+
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockNodePlacementValidator) IsNodeAllowed(
+	ctx context.Context,
+	host *capabilities.Host,
+	nodeName string,
+	spec *domain.VirtualMachineTemplateSpec,
+) (bool, error) {
+	args := m.Called(ctx, host, nodeName, spec)
+
+	return args.Bool(0), args.Error(1)
+}
+
+type mockBindingsLoader struct {
+	mock.Mock
+}
+
+func (m *mockBindingsLoader) LoadBindings(
+	ctx context.Context,
+	host *capabilities.Host,
+	ref *domain.ConfigMapReference,
+) ([]domain.NamespaceDeviceBinding, error) {
+	args := m.Called(ctx, host, ref)
+
+	bindings, _ := args.Get(0).([]domain.NamespaceDeviceBinding)
+	return bindings, args.Error(1)
+}
@@ -9,12 +9,18 @@ import (
 	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-pci-devices/internal/domain"
 	"github.com/francoispqt/onelog"
 	kubewarden "github.com/kubewarden/policy-sdk-go"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
 	kubewardenProtocol "github.com/kubewarden/policy-sdk-go/protocol"
 )
 
 const HTTPBadRequestStatusCode = 400
 
-func ValidateRequest(ctx context.Context, payload []byte) ([]byte, error) {
+func ValidateRequest(
+	ctx context.Context,
+	payload []byte,
+	validator nodePlacementValidator,
+	loader bindingsLoader,
+) ([]byte, error) {
 	validationRequest := kubewardenProtocol.ValidationRequest{}
 	err := json.Unmarshal(payload, &validationRequest)
 	if err != nil {
@@ -43,6 +49,18 @@ func ValidateRequest(ctx context.Context, payload []byte) ([]byte, error) {
 	gpuList := virtualMachineObject.Spec.Template.Spec.Domain.Devices.GPUS
 	pciDeviceList := virtualMachineObject.Spec.Template.Spec.Domain.Devices.HostDevices
 
+	host := capabilities.NewHost()
+
+	// a VM without PCI devices doesn't depend on the ConfigMap, even when it cannot be loaded
+	if len(gpuList) > 0 || len(pciDeviceList) > 0 {
+		settings, err = loadConfigMapBindings(ctx, &host, loader, &settings)
+		if err != nil {
+			return kubewarden.RejectRequest(
+				kubewarden.Message(err.Error()),
+				kubewarden.Code(HTTPBadRequestStatusCode))
+		}
+	}
+
 	l := logger.FromContext(ctx).With(func(entry onelog.Entry) {
 		entry.String("namespace", namespace)
 		entry.String("devices", fmt.Sprintf("%+v", pciDeviceList))
@@ -62,6 +80,176 @@ func ValidateRequest(ctx context.Context, payload []byte) ([]byte, error) {
 		}
 	}
 
+	if settings.EnforceNodePlacement {
+		err = validateNodePlacement(ctx, &host, validator, &virtualMachineObject)
+		if err != nil {
+			l.InfoWithFields("VM_REJECTED node placement", func(entry onelog.Entry) {
+				entry.String("error", err.Error())
+			})
+			return kubewarden.RejectRequest(
+				kubewarden.Message(err.Error()),
+				kubewarden.Code(HTTPBadRequestStatusCode))
+		}
+	}
+
+	if settings.MutateNodeAffinity {
+		return mutateNodeAffinity(ctx, &host, validator, &settings, &virtualMachineObject, virtualMachineJSON)
+	}
+
 	l.Info("VM_ALLOWED namespace")
 	return kubewarden.AcceptRequest()
 }
+
+// validateNodePlacement ensures that the VM can be scheduled on the node of every PCI device it requests.
+func validateNodePlacement(
+	ctx context.Context,
+	host *capabilities.Host,
+	validator nodePlacementValidator,
+	virtualMachine *domain.VirtualMachine,
+) error {
+	spec := &virtualMachine.Spec.Template.Spec
+
+	for _, device := range virtualMachine.PCIDevices() {
+		nodeName, err := validator.FindDeviceNode(ctx, host, device.Name)
+		if err != nil {
+			return fmt.Errorf("cannot find the node of PCI DEVICE '%s': %w", device.Name, err)
+		}
+
+		allowed, err := validator.IsNodeAllowed(ctx, host, nodeName, spec)
+		if err != nil {
+			return fmt.Errorf("cannot verify node '%s' for PCI DEVICE '%s': %w", nodeName, device.Name, err)
+		}
+
+		if !allowed {
+			return fmt.Errorf(
+				"PCI DEVICE '%s' is on node '%s', which the VM node placement does not allow", device.Name, nodeName)
+		}
+	}
+
+	return nil
+}
+
+// loadConfigMapBindings merges the bindings of the settings' ConfigMap into the inline bindings.
+// When the ConfigMap cannot be loaded, the failure policy decides whether the inline bindings are used on their own.
+func loadConfigMapBindings(
+	ctx context.Context,
+	host *capabilities.Host,
+	loader bindingsLoader,
+	settings *domain.Settings,
+) (domain.Settings, error) {
+	if settings.BindingsConfigMap == nil {
+		return *settings, nil
+	}
+
+	merged, err := mergeConfigMapBindings(ctx, host, loader, settings)
+	if err == nil {
+		return merged, nil
+	}
+
+	if settings.IgnoreConfigMapFailures() {
+		logger.FromContext(ctx).InfoWithFields("CONFIGMAP_IGNORED bindings", func(entry onelog.Entry) {
+			entry.String("error", err.Error())
+		})
+		return *settings, nil
+	}
+
+	return domain.Settings{}, err
+}
+
+func mergeConfigMapBindings(
+	ctx context.Context,
+	host *capabilities.Host,
+	loader bindingsLoader,
+	settings *domain.Settings,
+) (domain.Settings, error) {
+	ref := settings.BindingsConfigMap
+	bindings, err := loader.LoadBindings(ctx, host, ref)
+	if err != nil {
+		return domain.Settings{}, fmt.Errorf(
+			"cannot load bindings from ConfigMap '%s/%s': %w", ref.Namespace, ref.Name, err)
+	}
+
+	return settings.WithBindings(ref.String(), bindings)
+}
+
+// mutateNodeAffinity requires the VM to run on the node of its PCI devices.
+func mutateNodeAffinity(
+	ctx context.Context,
+	host *capabilities.Host,
+	validator nodePlacementValidator,
+	settings *domain.Settings,
+	virtualMachine *domain.VirtualMachine,
+	virtualMachineJSON json.RawMessage,
+) ([]byte, error) {
+	nodeName, err := findDevicesNode(ctx, host, validator, settings, virtualMachine)
+	if err != nil {
+		return kubewarden.RejectRequest(
+			kubewarden.Message(err.Error()),
+			kubewarden.Code(HTTPBadRequestStatusCode))
+	}
+
+	if nodeName == "" {
+		return kubewarden.AcceptRequest()
+	}
+
+	mutatedObject := map[string]interface{}{}
+	err = json.Unmarshal(virtualMachineJSON, &mutatedObject)
+	if err != nil {
+		return kubewarden.RejectRequest(
+			kubewarden.Message(err.Error()),
+			kubewarden.Code(HTTPBadRequestStatusCode))
+	}
+
+	changed, err := domain.RequireNode(mutatedObject, nodeName)
+	if err != nil {
+		return kubewarden.RejectRequest(
+			kubewarden.Message(fmt.Sprintf("cannot require node '%s': %v", nodeName, err)),
+			kubewarden.Code(HTTPBadRequestStatusCode))
+	}
+
+	if !changed {
+		return kubewarden.AcceptRequest()
+	}
+
+	logger.FromContext(ctx).InfoWithFields("VM_MUTATED node affinity", func(entry onelog.Entry) {
+		entry.String("node", nodeName)
+	})
+	return kubewarden.MutateRequest(mutatedObject)
+}
+
+// findDevicesNode returns the node shared by every PCI device of the VM, or an empty string without devices.
+// The static deviceNodes setting is preferred over looking up the PCIDevice objects.
+func findDevicesNode(
+	ctx context.Context,
+	host *capabilities.Host,
+	validator nodePlacementValidator,
+	settings *domain.Settings,
+	virtualMachine *domain.VirtualMachine,
+) (string, error) {
+	nodeName := ""
+	firstDevice := ""
+
+	for _, device := range virtualMachine.PCIDevices() {
+		deviceNode, ok := settings.DeviceNode(device.Name)
+		if !ok {
+			var err error
+			deviceNode, err = validator.FindDeviceNode(ctx, host, device.Name)
+			if err != nil {
+				return "", fmt.Errorf("cannot find the node of PCI DEVICE '%s': %w", device.Name, err)
+			}
+		}
+
+		if nodeName != "" && deviceNode != nodeName {
+			return "", fmt.Errorf(
+				"PCI DEVICE '%s' is on node '%s' and PCI DEVICE '%s' is on node '%s', a VM cannot use both",
+				firstDevice, nodeName, device.Name, deviceNode)
+		}
+
+		if nodeName == "" {
+			nodeName = deviceNode
+			firstDevice = device.Name
+		}
+	}
+
+	return nodeName, nil
+}
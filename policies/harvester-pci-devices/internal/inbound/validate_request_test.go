@@ -13,6 +13,7 @@ import (
 	kubewardenProtocol "github.com/kubewarden/policy-sdk-go/protocol"
 	kubewardenTesting "github.com/kubewarden/policy-sdk-go/testing"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func getVMObjectGPU(vmName, namespace, gpu string) domain.VirtualMachine {
@@ -141,6 +142,50 @@ func TestApproval(t *testing.T) {
 			},
 			result: true,
 		},
+		{
+			name: "Approve: unbound Device in exclusive mode",
+			getPayload: func() []byte {
+				settings := domain.Settings{
+					NamespaceDeviceBindings: []domain.NamespaceDeviceBinding{
+						{
+							Device:    "gpu-1",
+							Namespace: "namespace-1",
+						},
+					},
+					Mode: domain.BindingModeExclusive,
+				}
+
+				vmObject := getVMObjectGPU("test-VM", "random-namespace", "gpu-2")
+
+				payload, err := kubewardenTesting.BuildValidationRequest(&vmObject, &settings)
+				assert.NoError(t, err)
+				return payload
+			},
+			result: true,
+		},
+		{
+			name: "Reject: bound Device for another namespace in exclusive mode",
+			getPayload: func() []byte {
+				settings := domain.Settings{
+					NamespaceDeviceBindings: []domain.NamespaceDeviceBinding{
+						{
+							Device:    "gpu-1",
+							Namespace: "namespace-1",
+						},
+					},
+					Mode: domain.BindingModeExclusive,
+				}
+
+				vmObject := getVMObjectGPU("test-VM", "random-namespace", "gpu-1")
+
+				payload, err := kubewardenTesting.BuildValidationRequest(&vmObject, &settings)
+				assert.NoError(t, err)
+				return payload
+			},
+			result:       false,
+			errorMessage: "PCI DEVICE 'gpu-1' is not allowed for namespace: 'random-namespace'",
+			errorCode:    inbound.HTTPBadRequestStatusCode,
+		},
 		{
 			name: "Reject: Bad payload",
 			getPayload: func() []byte {
@@ -234,7 +279,7 @@ func TestApproval(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			payload := tt.getPayload()
-			responsePayload, err := inbound.ValidateRequest(ctx, payload)
+			responsePayload, err := inbound.ValidateRequest(ctx, payload, &mockNodePlacementValidator{}, &mockBindingsLoader{})
 			require.NoError(t, err)
 
 			var response kubewardenProtocol.ValidationResponse
@@ -249,3 +294,336 @@ func TestApproval(t *testing.T) {
 		})
 	}
 }
+
+func TestNodePlacement(t *testing.T) {
+	ctx := context.Background()
+	settings := domain.Settings{
+		NamespaceDeviceBindings: []domain.NamespaceDeviceBinding{
+			{
+				Device:    "gpu-1",
+				Namespace: "namespace-1",
+			},
+		},
+		EnforceNodePlacement: true,
+	}
+
+	tests := []struct {
+		name         string
+		nodeName     string
+		findError    error
+		allowed      bool
+		allowedError error
+		result       bool
+		errorMessage string
+	}{
+		{
+			name:     "Approve: node placement reaches the device node",
+			nodeName: "node-1",
+			allowed:  true,
+			result:   true,
+		},
+		{
+			name:         "Reject: node placement excludes the device node",
+			nodeName:     "node-1",
+			allowed:      false,
+			result:       false,
+			errorMessage: "PCI DEVICE 'gpu-1' is on node 'node-1', which the VM node placement does not allow",
+		},
+		{
+			name:         "Reject: device node cannot be found",
+			findError:    assert.AnError,
+			result:       false,
+			errorMessage: "cannot find the node of PCI DEVICE 'gpu-1': " + assert.AnError.Error(),
+		},
+		{
+			name:         "Reject: node cannot be verified",
+			nodeName:     "node-1",
+			allowedError: assert.AnError,
+			result:       false,
+			errorMessage: "cannot verify node 'node-1' for PCI DEVICE 'gpu-1': " + assert.AnError.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vmObject := getVMObjectGPU("test-VM", "namespace-1", "gpu-1")
+			payload, err := kubewardenTesting.BuildValidationRequest(&vmObject, &settings)
+			require.NoError(t, err)
+
+			validator := new(mockNodePlacementValidator)
+			validator.On("FindDeviceNode", mock.Anything, mock.Anything, "gpu-1").
+				Return(tt.nodeName, tt.findError)
+			validator.On("IsNodeAllowed", mock.Anything, mock.Anything, tt.nodeName, mock.Anything).
+				Return(tt.allowed, tt.allowedError)
+
+			responsePayload, err := inbound.ValidateRequest(ctx, payload, validator, &mockBindingsLoader{})
+			require.NoError(t, err)
+
+			var response kubewardenProtocol.ValidationResponse
+			err = json.Unmarshal(responsePayload, &response)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.result, response.Accepted)
+			if !tt.result {
+				assert.Equal(t, tt.errorMessage, *response.Message)
+				assert.Equal(t, uint16(inbound.HTTPBadRequestStatusCode), *response.Code)
+			}
+		})
+	}
+}
+
+func TestConfigMapBindings(t *testing.T) {
+	ctx := context.Background()
+	configMap := &domain.ConfigMapReference{
+		Namespace: "harvester-system",
+		Name:      "pci-bindings",
+		Key:       "bindings.json",
+	}
+
+	tests := []struct {
+		name          string
+		failurePolicy domain.FailurePolicy
+		bindings      []domain.NamespaceDeviceBinding
+		loadError     error
+		result        bool
+		errorMessage  string
+	}{
+		{
+			name: "Approve: device bound in the ConfigMap",
+			bindings: []domain.NamespaceDeviceBinding{
+				{Namespace: "namespace-1", Device: "gpu-1"},
+			},
+			result: true,
+		},
+		{
+			name: "Reject: device not bound in the ConfigMap",
+			bindings: []domain.NamespaceDeviceBinding{
+				{Namespace: "namespace-1", Device: "gpu-2"},
+			},
+			result:       false,
+			errorMessage: "PCI DEVICE 'gpu-1' is not allowed for namespace: 'namespace-1'",
+		},
+		{
+			name:         "Reject: ConfigMap cannot be loaded",
+			loadError:    assert.AnError,
+			result:       false,
+			errorMessage: "cannot load bindings from ConfigMap 'harvester-system/pci-bindings': " + assert.AnError.Error(),
+		},
+		{
+			name: "Reject: ConfigMap with invalid bindings",
+			bindings: []domain.NamespaceDeviceBinding{
+				{Namespace: "namespace-1"},
+			},
+			result: false,
+			errorMessage: "ConfigMap 'harvester-system/pci-bindings' key 'bindings.json'[0]: " +
+				"namespace and device must be specified",
+		},
+		{
+			name: "Reject: ConfigMap binding duplicate of an inline binding",
+			bindings: []domain.NamespaceDeviceBinding{
+				{Namespace: "namespace-1", Device: "gpu-1"},
+				{Namespace: "namespace-2", Device: "gpu-2"},
+			},
+			result: false,
+			errorMessage: "ConfigMap 'harvester-system/pci-bindings' key 'bindings.json'[1]: " +
+				"duplicate of namespaceDeviceBindings[0]",
+		},
+		{
+			name:          "Reject: ConfigMap ignored, device not bound inline",
+			failurePolicy: domain.FailurePolicyIgnore,
+			loadError:     assert.AnError,
+			result:        false,
+			errorMessage:  "PCI DEVICE 'gpu-1' is not allowed for namespace: 'namespace-1'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := domain.Settings{
+				NamespaceDeviceBindings: []domain.NamespaceDeviceBinding{
+					{Namespace: "namespace-2", Device: "gpu-2"},
+				},
+				BindingsConfigMap:      configMap,
+				ConfigMapFailurePolicy: tt.failurePolicy,
+			}
+			vmObject := getVMObjectGPU("test-VM", "namespace-1", "gpu-1")
+			payload, err := kubewardenTesting.BuildValidationRequest(&vmObject, &settings)
+			require.NoError(t, err)
+
+			loader := new(mockBindingsLoader)
+			loader.On("LoadBindings", mock.Anything, mock.Anything, configMap).
+				Return(tt.bindings, tt.loadError)
+
+			responsePayload, err := inbound.ValidateRequest(ctx, payload, &mockNodePlacementValidator{}, loader)
+			require.NoError(t, err)
+
+			var response kubewardenProtocol.ValidationResponse
+			err = json.Unmarshal(responsePayload, &response)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.result, response.Accepted)
+			if !tt.result {
+				assert.Equal(t, tt.errorMessage, *response.Message)
+				assert.Equal(t, uint16(inbound.HTTPBadRequestStatusCode), *response.Code)
+			}
+		})
+	}
+}
+
+func TestConfigMapBindingsWithoutDevices(t *testing.T) {
+	ctx := context.Background()
+	settings := domain.Settings{
+		BindingsConfigMap: &domain.ConfigMapReference{
+			Namespace: "harvester-system",
+			Name:      "pci-bindings",
+			Key:       "bindings.json",
+		},
+	}
+	vmObject := getVMObjectGPU("test-VM", "namespace-1", "gpu-1")
+	vmObject.Spec.Template.Spec.Domain.Devices.GPUS = nil
+	payload, err := kubewardenTesting.BuildValidationRequest(&vmObject, &settings)
+	require.NoError(t, err)
+
+	// the ConfigMap isn't loaded, so it cannot reject the VM
+	loader := new(mockBindingsLoader)
+	responsePayload, err := inbound.ValidateRequest(ctx, payload, &mockNodePlacementValidator{}, loader)
+	require.NoError(t, err)
+
+	var response kubewardenProtocol.ValidationResponse
+	err = json.Unmarshal(responsePayload, &response)
+	require.NoError(t, err)
+
+	assert.True(t, response.Accepted)
+	loader.AssertNotCalled(t, "LoadBindings", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestMutateNodeAffinity(t *testing.T) {
+	ctx := context.Background()
+	requiredNode := map[string]interface{}{
+		"nodeAffinity": map[string]interface{}{
+			"requiredDuringSchedulingIgnoredDuringExecution": map[string]interface{}{
+				"nodeSelectorTerms": []interface{}{
+					map[string]interface{}{
+						"matchFields": []interface{}{
+							map[string]interface{}{
+								"key":      "metadata.name",
+								"operator": "In",
+								"values":   []interface{}{"node-1"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		deviceNodes  map[string]string
+		devices      []string
+		lookupNodes  map[string]string
+		affinity     *domain.Affinity
+		result       bool
+		mutated      bool
+		errorMessage string
+	}{
+		{
+			name:        "Mutate: node from the deviceNodes setting",
+			deviceNodes: map[string]string{"gpu-1": "node-1"},
+			devices:     []string{"gpu-1"},
+			result:      true,
+			mutated:     true,
+		},
+		{
+			name:        "Mutate: node from the PCIDevice",
+			devices:     []string{"gpu-1", "gpu-2"},
+			lookupNodes: map[string]string{"gpu-1": "node-1", "gpu-2": "node-1"},
+			result:      true,
+			mutated:     true,
+		},
+		{
+			name:    "Accept: VM already requires the node",
+			devices: []string{"gpu-1"},
+			affinity: &domain.Affinity{
+				NodeAffinity: &domain.NodeAffinity{
+					RequiredDuringScheduling: &domain.NodeSelector{
+						NodeSelectorTerms: []domain.NodeSelectorTerm{
+							{
+								MatchFields: []domain.NodeSelectorRequirement{
+									{Key: "metadata.name", Operator: "In", Values: []string{"node-1"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			deviceNodes: map[string]string{"gpu-1": "node-1"},
+			result:      true,
+			mutated:     false,
+		},
+		{
+			name:    "Accept: VM without devices",
+			devices: []string{},
+			result:  true,
+			mutated: false,
+		},
+		{
+			name:         "Reject: devices on different nodes",
+			deviceNodes:  map[string]string{"gpu-1": "node-1"},
+			devices:      []string{"gpu-1", "gpu-2"},
+			lookupNodes:  map[string]string{"gpu-2": "node-2"},
+			result:       false,
+			errorMessage: "PCI DEVICE 'gpu-1' is on node 'node-1' and PCI DEVICE 'gpu-2' is on node 'node-2', a VM cannot use both",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := domain.Settings{
+				MutateNodeAffinity: true,
+				DeviceNodes:        tt.deviceNodes,
+			}
+			validator := new(mockNodePlacementValidator)
+			vmObject := getVMObjectGPU("test-VM", "namespace-1", "")
+			vmObject.Spec.Template.Spec.Affinity = tt.affinity
+			vmObject.Spec.Template.Spec.Domain.Devices.GPUS = []domain.PCIDevice{}
+			for _, device := range tt.devices {
+				settings.NamespaceDeviceBindings = append(settings.NamespaceDeviceBindings,
+					domain.NamespaceDeviceBinding{Namespace: "namespace-1", Device: device})
+				vmObject.Spec.Template.Spec.Domain.Devices.GPUS = append(vmObject.Spec.Template.Spec.Domain.Devices.GPUS,
+					domain.PCIDevice{Name: device, DeviceName: "gpu-device-name"})
+			}
+			for device, node := range tt.lookupNodes {
+				validator.On("FindDeviceNode", mock.Anything, mock.Anything, device).Return(node, nil)
+			}
+
+			payload, err := kubewardenTesting.BuildValidationRequest(&vmObject, &settings)
+			require.NoError(t, err)
+
+			responsePayload, err := inbound.ValidateRequest(ctx, payload, validator, &mockBindingsLoader{})
+			require.NoError(t, err)
+
+			var response kubewardenProtocol.ValidationResponse
+			err = json.Unmarshal(responsePayload, &response)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.result, response.Accepted)
+			if !tt.result {
+				assert.Equal(t, tt.errorMessage, *response.Message)
+				assert.Equal(t, uint16(inbound.HTTPBadRequestStatusCode), *response.Code)
+				return
+			}
+
+			if !tt.mutated {
+				assert.Nil(t, response.MutatedObject)
+				return
+			}
+
+			mutatedObject, ok := response.MutatedObject.(map[string]interface{})
+			require.True(t, ok)
+			spec := mutatedObject["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"]
+			assert.Equal(t, requiredNode, spec.(map[string]interface{})["affinity"])
+			assert.Equal(t, "test-VM", mutatedObject["metadata"].(map[string]interface{})["name"])
+		})
+	}
+}
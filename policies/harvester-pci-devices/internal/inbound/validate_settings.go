@@ -2,7 +2,6 @@ package inbound
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 
 	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-pci-devices/internal/core/logger"
@@ -14,15 +13,15 @@ func ValidateSettings(ctx context.Context, payload []byte) ([]byte, error) {
 	l := logger.FromContext(ctx)
 	l.Info("validating settings")
 
-	settings := domain.Settings{}
-	err := json.Unmarshal(payload, &settings)
+	settings, err := domain.NewSettingsFromJSON(payload)
 	if err != nil {
 		return kubewarden.RejectSettings(kubewarden.Message(fmt.Sprintf("Invalid settings JSON: %v", err)))
 	}
 
-	valid := settings.Valid(ctx)
-	if !valid {
-		return kubewarden.RejectSettings("settings are not valid")
+	err = settings.Validate()
+	if err != nil {
+		l.Info(fmt.Sprintf("settings are not valid: %v", err))
+		return kubewarden.RejectSettings(kubewarden.Message(fmt.Sprintf("settings are not valid: %v", err)))
 	}
 
 	return kubewarden.AcceptSettings()
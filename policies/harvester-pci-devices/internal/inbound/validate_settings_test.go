@@ -47,10 +47,10 @@ func TestValidateSettings(t *testing.T) {
 					}
 				]
 			}`),
-			result: `{"valid":false,"message":"settings are not valid"}`,
+			result: `{"valid":false,"message":"settings are not valid: namespaceDeviceBindings[0]: namespace and device must be specified"}`,
 		},
 		{
-			name: "Missing namespace",
+			name: "Missing device",
 			payload: []byte(`{
 				"namespaceDeviceBindings": [
 					{
@@ -58,7 +58,69 @@ func TestValidateSettings(t *testing.T) {
 					}
 				]
 			}`),
-			result: `{"valid":false,"message":"settings are not valid"}`,
+			result: `{"valid":false,"message":"settings are not valid: namespaceDeviceBindings[0]: namespace and device must be specified"}`,
+		},
+		{
+			name: "Unknown field",
+			payload: []byte(`{
+				"namespaceDeviceindings": [
+					{
+						"namespace": "test-namespace-1",
+						"device": "gpu-1"
+					}
+				]
+			}`),
+			result: `{"valid":false,"message":"Invalid settings JSON: json: unknown field \"namespaceDeviceindings\""}`,
+		},
+		{
+			name: "Unknown binding field",
+			payload: []byte(`{
+				"namespaceDeviceBindings": [
+					{
+						"namespace": "test-namespace-1",
+						"devices": "gpu-1"
+					}
+				]
+			}`),
+			result: `{"valid":false,"message":"Invalid settings JSON: json: unknown field \"devices\""}`,
+		},
+		{
+			name: "Every problem is listed",
+			payload: []byte(`{
+				"namespaceDeviceBindings": [
+					{
+						"namespace": "test-namespace-1",
+						"device": "gpu-1"
+					},
+					{
+						"namespace": "test-namespace-1"
+					},
+					{
+						"namespace": "test-namespace-1",
+						"device": "gpu-1"
+					}
+				],
+				"deviceNodes": {
+					"gpu-1": "node-1"
+				}
+			}`),
+			result: `{"valid":false,"message":"settings are not valid: ` +
+				`namespaceDeviceBindings[1]: namespace and device must be specified; ` +
+				`namespaceDeviceBindings[2]: duplicate of namespaceDeviceBindings[0]; ` +
+				`deviceNodes: requires mutateNodeAffinity"}`,
+		},
+		{
+			name: "Unknown ConfigMap failure policy",
+			payload: []byte(`{
+				"bindingsConfigMap": {
+					"namespace": "harvester-system",
+					"name": "pci-bindings",
+					"key": "bindings.json"
+				},
+				"configMapFailurePolicy": "Retry"
+			}`),
+			result: `{"valid":false,"message":"settings are not valid: ` +
+				`configMapFailurePolicy: unknown policy 'Retry', expected 'Fail' or 'Ignore'"}`,
 		},
 	}
 	for _, tt := range tests {
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The extractors mirror the ones of harvester-restricted-network, so that both policies find the same VLANs
+// and cluster networks in a NetworkAttachmentDefinition. The tests of both policies read the same
+// test_data/network_attachment_definitions.json.
+
+// networkExtractor works out the networks of a plugin, from the fields its CNI type uses.
+// A plugin without a VLAN or an underlay returns no network.
+type networkExtractor func(plugin *cniPlugin, defaultClusterNetwork string) ([]vlanNetwork, error)
+
+// newNetworkExtractors returns the extractor of every supported CNI type.
+// Other types are read like the bridge plugin, from their `bridge`, `vlan` and `vlanTrunk` fields.
+func newNetworkExtractors() map[string]networkExtractor {
+	return map[string]networkExtractor{
+		"bridge":   extractBridgeNetworks,
+		"sriov":    extractSRIOVNetworks,
+		"macvlan":  extractMasterNetworks,
+		"ipvlan":   extractMasterNetworks,
+		"kube-ovn": extractKubeOVNNetworks,
+	}
+}
+
+// extractBridgeNetworks reads the VLAN and the VLAN trunk of a bridge port.
+func extractBridgeNetworks(plugin *cniPlugin, defaultClusterNetwork string) ([]vlanNetwork, error) {
+	clusterNetwork := bridgeClusterNetwork(plugin, defaultClusterNetwork)
+	if err := validateVLAN(plugin.VLAN); err != nil {
+		return nil, err
+	}
+
+	networks := []vlanNetwork{}
+	if plugin.VLAN != untaggedVLAN {
+		networks = append(networks, vlanNetwork{clusterNetwork: clusterNetwork, vlan: plugin.VLAN})
+	}
+
+	for _, entry := range plugin.VLANTrunk {
+		r, err := entry.vlanRange()
+		if err != nil {
+			return nil, err
+		}
+
+		for vlan := r.start; vlan <= r.end; vlan++ {
+			networks = append(networks, vlanNetwork{clusterNetwork: clusterNetwork, vlan: vlan})
+		}
+	}
+
+	return networks, nil
+}
+
+// bridgeClusterNetwork returns the cluster network of the bridge, which Harvester names after it.
+func bridgeClusterNetwork(plugin *cniPlugin, defaultClusterNetwork string) string {
+	if plugin.Bridge == "" {
+		return defaultClusterNetwork
+	}
+
+	return strings.TrimSuffix(plugin.Bridge, bridgeSuffix)
+}
+
+// extractSRIOVNetworks reads the VLAN that the SR-IOV virtual function is tagged with.
+// The underlay is a physical function, which is only known through the cluster network label.
+func extractSRIOVNetworks(plugin *cniPlugin, defaultClusterNetwork string) ([]vlanNetwork, error) {
+	if err := validateVLAN(plugin.VLAN); err != nil {
+		return nil, err
+	}
+
+	if plugin.VLAN == untaggedVLAN {
+		return []vlanNetwork{}, nil
+	}
+
+	return []vlanNetwork{{clusterNetwork: defaultClusterNetwork, vlan: plugin.VLAN}}, nil
+}
+
+// validateVLAN rejects the VLANs out of range, which would otherwise be unrestricted.
+func validateVLAN(vlan int) error {
+	if vlan != untaggedVLAN && !isVLAN(vlan) {
+		return fmt.Errorf("vlan %d is out of range %d-%d", vlan, minVLAN, maxVLAN)
+	}
+
+	return nil
+}
+
+// extractMasterNetworks reads the VLAN of a macvlan or ipvlan master, e.g. 300 for "eth0.300".
+// A master on a Harvester bridge, e.g. "data-br.300", is on the cluster network of the bridge.
+func extractMasterNetworks(plugin *cniPlugin, defaultClusterNetwork string) ([]vlanNetwork, error) {
+	parent, vlanValue, tagged := strings.Cut(plugin.Master, ".")
+	if !tagged {
+		return []vlanNetwork{}, nil
+	}
+
+	vlan, err := strconv.Atoi(vlanValue)
+	if err != nil {
+		return nil, fmt.Errorf("master '%s' is not a VLAN interface", plugin.Master)
+	}
+
+	if !isVLAN(vlan) {
+		return nil, fmt.Errorf("master '%s' has a VLAN out of range %d-%d", plugin.Master, minVLAN, maxVLAN)
+	}
+
+	clusterNetwork := defaultClusterNetwork
+	if strings.HasSuffix(parent, bridgeSuffix) {
+		clusterNetwork = strings.TrimSuffix(parent, bridgeSuffix)
+	}
+
+	return []vlanNetwork{{clusterNetwork: clusterNetwork, vlan: vlan}}, nil
+}
+
+// extractKubeOVNNetworks reads the provider of a kube-ovn network, which is its underlay.
+// kube-ovn keeps the VLAN on the Subnet, so the network itself is untagged.
+func extractKubeOVNNetworks(plugin *cniPlugin, _ string) ([]vlanNetwork, error) {
+	if plugin.Provider == "" {
+		return []vlanNetwork{}, nil
+	}
+
+	return []vlanNetwork{{clusterNetwork: plugin.Provider}}, nil
+}
+
+// vlanTrunkEntry is either a single VLAN in ID, or a range of VLANs from MinID to MaxID.
+type vlanTrunkEntry struct {
+	ID    *int `json:"id"`
+	MinID *int `json:"minID"`
+	MaxID *int `json:"maxID"`
+}
+
+// vlanRange returns the VLANs of the entry, like the bridge plugin reads them.
+func (e *vlanTrunkEntry) vlanRange() (vlanRange, error) {
+	var r vlanRange
+	switch {
+	case e.ID != nil && e.MinID == nil && e.MaxID == nil:
+		r = vlanRange{start: *e.ID, end: *e.ID}
+	case e.ID == nil && e.MinID != nil && e.MaxID != nil:
+		r = vlanRange{start: *e.MinID, end: *e.MaxID}
+	default:
+		return vlanRange{}, errors.New("a vlanTrunk entry needs either an id, or a minID and a maxID")
+	}
+
+	err := r.validate()
+	if err != nil {
+		return vlanRange{}, fmt.Errorf("invalid vlanTrunk entry: %w", err)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	bridgeBindingMethod     = "bridge"
+	masqueradeBindingMethod = "masquerade"
+	sriovBindingMethod      = "sriov"
+)
+
+// NetworkInterfaceBinding limits the binding methods of the interfaces connected to a network.
+type NetworkInterfaceBinding struct {
+	// Network is "namespace/name".
+	Network string `json:"network"`
+	// Methods are "bridge", "masquerade", "sriov" or the name of a binding plugin, e.g. "passt".
+	Methods []string `json:"methods"`
+}
+
+// bindingMethod returns the binding method of the interface, KubeVirt uses "bridge" when there is none.
+func (i *vmInterface) bindingMethod() string {
+	switch {
+	case i.Masquerade != nil:
+		return masqueradeBindingMethod
+	case i.SRIOV != nil:
+		return sriovBindingMethod
+	case i.Binding != nil:
+		return i.Binding.Name
+	default:
+		return bridgeBindingMethod
+	}
+}
+
+func (s *Settings) interfaceBindingProblems() []string {
+	problems := []string{}
+	for i, binding := range s.NetworkInterfaceBindings {
+		if binding.Network == "" || len(binding.Methods) == 0 || slices.Contains(binding.Methods, "") {
+			problems = append(problems,
+				fmt.Sprintf("networkInterfaceBindings[%d]: network and methods must be specified", i))
+			continue
+		}
+
+		if !strings.Contains(binding.Network, "/") {
+			problems = append(problems,
+				fmt.Sprintf("networkInterfaceBindings[%d]: network '%s' must be namespace/name", i, binding.Network))
+			continue
+		}
+
+		if _, err := normalizeNetworkName(binding.Network, ""); err != nil {
+			problems = append(problems, fmt.Sprintf("networkInterfaceBindings[%d]: %v", i, err))
+		}
+	}
+
+	return problems
+}
+
+// isInterfaceBindingAllowed verifies if an interface can use a binding method on a network:
+//   - a network with interface bindings can only use their methods
+//   - a restricted method can only be used by the networks whose bindings list it
+//   - any other method is unrestricted
+//
+// The network is "namespace/name", or empty for the pod network.
+func (s *Settings) isInterfaceBindingAllowed(network, method string) bool {
+	bound := false
+	for _, binding := range s.NetworkInterfaceBindings {
+		if binding.Network != network {
+			continue
+		}
+
+		if slices.Contains(binding.Methods, method) {
+			return true
+		}
+		bound = true
+	}
+
+	return !bound && !slices.Contains(s.RestrictedBindingMethods, method)
+}
+
+// interfaceRejection checks every interface of the VM against the network of the same name, and its MAC address
+// against the MAC prefixes of the namespace.
+// It returns why an interface is rejected, or an empty string when they're all allowed.
+func interfaceRejection(settings *Settings, namespace string, vmSpec *vmNetworks) (string, error) {
+	networks := map[string]*vmNetwork{}
+	for i := range vmSpec.Networks {
+		networks[vmSpec.Networks[i].Name] = &vmSpec.Networks[i]
+	}
+
+	for _, vmInterface := range vmSpec.Domain.Devices.Interfaces {
+		network, ok := networks[vmInterface.Name]
+		if !ok {
+			return fmt.Sprintf("Interface '%s' refers to an undeclared network", vmInterface.Name), nil
+		}
+
+		networkName := ""
+		if network.Pod == nil && network.Multus.NetworkName != "" {
+			var err error
+			networkName, err = normalizeNetworkName(network.Multus.NetworkName, namespace)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		method := vmInterface.bindingMethod()
+		if !settings.isInterfaceBindingAllowed(networkName, method) {
+			return fmt.Sprintf("Interface '%s' cannot use the '%s' binding method", vmInterface.Name, method), nil
+		}
+
+		// KubeVirt assigns a MAC address when there is none
+		if vmInterface.MacAddress == "" {
+			continue
+		}
+
+		macAddress, err := vmInterface.parseMACAddress()
+		if err != nil {
+			return "", err
+		}
+
+		if !settings.isMACAddressAllowed(namespace, macAddress) {
+			return fmt.Sprintf("MAC address %s of interface '%s' is not allowed for namespace: '%s'",
+				macAddress, vmInterface.Name, namespace), nil
+		}
+	}
+
+	return "", nil
+}
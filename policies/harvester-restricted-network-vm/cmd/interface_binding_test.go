@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterfaceBindingProblems(t *testing.T) {
+	settings := Settings{
+		NetworkInterfaceBindings: []NetworkInterfaceBinding{
+			{Network: "namespace-1/network-1", Methods: []string{"sriov", "bridge"}},
+			{Network: "namespace-1/network-2"},
+			{Network: "network-3", Methods: []string{"bridge"}},
+			{Network: "namespace-1/Network-4", Methods: []string{"bridge"}},
+		},
+	}
+
+	assert.Equal(t, []string{
+		"networkInterfaceBindings[1]: network and methods must be specified",
+		"networkInterfaceBindings[2]: network 'network-3' must be namespace/name",
+		"networkInterfaceBindings[3]: network 'namespace-1/Network-4' has an invalid name 'Network-4'",
+	}, settings.interfaceBindingProblems())
+}
+
+func TestIsInterfaceBindingAllowed(t *testing.T) {
+	settings := Settings{
+		NetworkInterfaceBindings: []NetworkInterfaceBinding{
+			{Network: "namespace-1/sriov-network", Methods: []string{"sriov"}},
+			{Network: "namespace-1/passt-network", Methods: []string{"passt", "bridge"}},
+		},
+		RestrictedBindingMethods: []string{"sriov"},
+	}
+
+	tests := []struct {
+		name    string
+		network string
+		method  string
+		allowed bool
+	}{
+		{name: "method of the network", network: "namespace-1/sriov-network", method: "sriov", allowed: true},
+		{name: "plugin of the network", network: "namespace-1/passt-network", method: "passt", allowed: true},
+		{name: "other method of a bound network", network: "namespace-1/sriov-network", method: "bridge"},
+		{name: "restricted method of another network", network: "namespace-1/network-1", method: "sriov"},
+		{name: "unrestricted method", network: "namespace-1/network-1", method: "masquerade", allowed: true},
+		{name: "pod network", network: "", method: "masquerade", allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.allowed, settings.isInterfaceBindingAllowed(tt.network, tt.method))
+		})
+	}
+}
+
+func TestInterfaceRejection(t *testing.T) {
+	settings := Settings{
+		NetworkInterfaceBindings: []NetworkInterfaceBinding{
+			{Network: "namespace-1/sriov-network", Methods: []string{"sriov"}},
+		},
+		RestrictedBindingMethods: []string{"sriov"},
+	}
+
+	tests := []struct {
+		name          string
+		spec          string
+		rejection     string
+		expectedError string
+	}{
+		{
+			name: "interfaces of their networks",
+			spec: `{"domain":{"devices":{"interfaces":[{"name":"default","masquerade":{}},` +
+				`{"name":"nic-1","sriov":{}},{"name":"nic-2"}]}},"networks":[{"name":"default","pod":{}},` +
+				`{"name":"nic-1","multus":{"networkName":"sriov-network"}},` +
+				`{"name":"nic-2","multus":{"networkName":"namespace-2/network-2"}}]}`,
+		},
+		{
+			name: "interface of an undeclared network",
+			spec: `{"domain":{"devices":{"interfaces":[{"name":"nic-1","bridge":{}}]}},` +
+				`"networks":[{"name":"nic-2","multus":{"networkName":"network-1"}}]}`,
+			rejection: "Interface 'nic-1' refers to an undeclared network",
+		},
+		{
+			name: "restricted method on another network",
+			spec: `{"domain":{"devices":{"interfaces":[{"name":"nic-1","sriov":{}}]}},` +
+				`"networks":[{"name":"nic-1","multus":{"networkName":"namespace-2/network-2"}}]}`,
+			rejection: "Interface 'nic-1' cannot use the 'sriov' binding method",
+		},
+		{
+			name: "default method on a bound network",
+			spec: `{"domain":{"devices":{"interfaces":[{"name":"nic-1"}]}},` +
+				`"networks":[{"name":"nic-1","multus":{"networkName":"namespace-1/sriov-network"}}]}`,
+			rejection: "Interface 'nic-1' cannot use the 'bridge' binding method",
+		},
+		{
+			name: "binding plugin",
+			spec: `{"domain":{"devices":{"interfaces":[{"name":"nic-1","binding":{"name":"passt"}}]}},` +
+				`"networks":[{"name":"nic-1","multus":{"networkName":"namespace-1/sriov-network"}}]}`,
+			rejection: "Interface 'nic-1' cannot use the 'passt' binding method",
+		},
+		{
+			name: "malformed network name",
+			spec: `{"domain":{"devices":{"interfaces":[{"name":"nic-1"}]}},` +
+				`"networks":[{"name":"nic-1","multus":{"networkName":"namespace-1/"}}]}`,
+			expectedError: "network 'namespace-1/' has an invalid name ''",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := vmNetworks{}
+			require.NoError(t, json.Unmarshal([]byte(tt.spec), &spec))
+
+			rejection, err := interfaceRejection(&settings, "namespace-1", &spec)
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.rejection, rejection)
+		})
+	}
+}
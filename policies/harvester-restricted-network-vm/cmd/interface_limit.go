@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+	kubewardenProtocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// NamespaceInterfaceLimit caps the interfaces of the VMs of a namespace.
+type NamespaceInterfaceLimit struct {
+	Namespace string `json:"namespace"`
+	// MaxInterfaces is the maximum number of interfaces on a VM, 0 is unlimited.
+	MaxInterfaces int `json:"maxInterfaces,omitempty"`
+	// NetworkLimits cap the interfaces on a network, summed over the VMs of the namespace.
+	NetworkLimits []NetworkInterfaceLimit `json:"networkLimits,omitempty"`
+}
+
+// NetworkInterfaceLimit caps the interfaces connected to a network.
+type NetworkInterfaceLimit struct {
+	// Network is "namespace/name", or "name" for a network of the namespace.
+	Network       string `json:"network"`
+	MaxInterfaces int    `json:"maxInterfaces"`
+}
+
+func (s *Settings) interfaceLimitProblems() []string {
+	problems := []string{}
+	for i, limit := range s.NamespaceInterfaceLimits {
+		if !isDNSLabel(limit.Namespace, maxNamespaceLength) {
+			problems = append(problems,
+				fmt.Sprintf("namespaceInterfaceLimits[%d]: invalid namespace '%s'", i, limit.Namespace))
+			continue
+		}
+
+		if limit.MaxInterfaces < 0 || (limit.MaxInterfaces == 0 && len(limit.NetworkLimits) == 0) {
+			problems = append(problems,
+				fmt.Sprintf(
+					"namespaceInterfaceLimits[%d]: a positive maxInterfaces or networkLimits must be specified", i))
+		}
+
+		for j, networkLimit := range limit.NetworkLimits {
+			if _, err := normalizeNetworkName(networkLimit.Network, limit.Namespace); err != nil {
+				problems = append(problems,
+					fmt.Sprintf("namespaceInterfaceLimits[%d].networkLimits[%d]: %v", i, j, err))
+			}
+			if networkLimit.MaxInterfaces <= 0 {
+				problems = append(problems,
+					fmt.Sprintf("namespaceInterfaceLimits[%d].networkLimits[%d]: maxInterfaces must be positive", i, j))
+			}
+		}
+	}
+
+	return problems
+}
+
+// interfaceLimits returns the interface limits of a namespace.
+func (s *Settings) interfaceLimits(namespace string) []NamespaceInterfaceLimit {
+	limits := []NamespaceInterfaceLimit{}
+	for _, limit := range s.NamespaceInterfaceLimits {
+		if limit.Namespace == namespace {
+			limits = append(limits, limit)
+		}
+	}
+
+	return limits
+}
+
+// interfacesPerNetwork counts the interfaces connected to every multus network of the VM, by "namespace/name".
+// Interfaces of the pod network, of an undeclared network or of an invalid network aren't counted.
+func (v *virtualMachine) interfacesPerNetwork() map[string]int {
+	networks := map[string]string{}
+	for _, network := range v.Spec.Template.Spec.Networks {
+		if network.Pod != nil || network.Multus.NetworkName == "" {
+			continue
+		}
+
+		networkName, err := normalizeNetworkName(network.Multus.NetworkName, v.Metadata.Namespace)
+		if err == nil {
+			networks[network.Name] = networkName
+		}
+	}
+
+	counts := map[string]int{}
+	for _, vmInterface := range v.Spec.Template.Spec.Domain.Devices.Interfaces {
+		if network, ok := networks[vmInterface.Name]; ok {
+			counts[network]++
+		}
+	}
+
+	return counts
+}
+
+// interfaceLimitRejection checks the interfaces of the object against the interface limits of its namespace.
+// A pool adds the interfaces of its template for every replica. A template version, and a VirtualMachineInstance
+// that a VirtualMachine runs, add none to the networks.
+// It returns why the object is rejected, or an empty string when it's within the limits.
+func interfaceLimitRejection(host *capabilities.Host, settings *Settings, object *vmObject) (string, error) {
+	vm := &object.vm
+	namespace := vm.Metadata.Namespace
+	limits := settings.interfaceLimits(namespace)
+	interfaceCount := len(vm.Spec.Template.Spec.Domain.Devices.Interfaces)
+
+	networkLimits := []NetworkInterfaceLimit{}
+	for _, limit := range limits {
+		if limit.MaxInterfaces > 0 && interfaceCount > limit.MaxInterfaces {
+			return fmt.Sprintf("VM '%s' has %d interfaces, only %d are allowed for namespace: '%s'",
+				vm.Metadata.Name, interfaceCount, limit.MaxInterfaces, namespace), nil
+		}
+		networkLimits = append(networkLimits, limit.NetworkLimits...)
+	}
+
+	counts := vm.interfacesPerNetwork()
+	if len(networkLimits) == 0 || len(counts) == 0 || object.replicas == 0 || object.ownedByVM {
+		return "", nil
+	}
+
+	usage, err := namespaceInterfaceUsage(host, object)
+	if err != nil {
+		return "", err
+	}
+
+	for _, networkLimit := range networkLimits {
+		// invalid networks are rejected with the settings
+		network, _ := normalizeNetworkName(networkLimit.Network, namespace)
+		added := counts[network] * object.replicas
+		if added > 0 && usage[network]+added > networkLimit.MaxInterfaces {
+			return fmt.Sprintf(
+				"Network '%s' has %d of %d interfaces in use in namespace: '%s', the %s cannot add %d",
+				network, usage[network], networkLimit.MaxInterfaces, namespace, object.kind, added), nil
+		}
+	}
+
+	return "", nil
+}
+
+// interfaceUsage counts the interfaces on every multus network of a namespace, by "namespace/name".
+type interfaceUsage map[string]int
+
+func (u interfaceUsage) add(vm *virtualMachine, replicas int) {
+	for network, count := range vm.interfacesPerNetwork() {
+		u[network] += count * replicas
+	}
+}
+
+// namespaceInterfaceUsage counts the interfaces on every multus network of the namespace of the object:
+//   - the interfaces of the VirtualMachines, but the ones of a pool, which the pool counts
+//   - the interfaces of the VirtualMachineInstances without a VirtualMachine, which run on their own
+//   - the interfaces of the template of the VirtualMachinePools, for every replica
+//
+// The object itself, i.e. its previous version on UPDATE, and the objects that cannot be decoded are left out.
+// VirtualMachineTemplateVersions run no VM, so they aren't counted.
+func namespaceInterfaceUsage(host *capabilities.Host, object *vmObject) (map[string]int, error) {
+	usage := interfaceUsage{}
+	for _, add := range []func(*capabilities.Host, *vmObject) error{usage.addVMs, usage.addVMIs, usage.addPools} {
+		if err := add(host, object); err != nil {
+			return nil, err
+		}
+	}
+
+	return usage, nil
+}
+
+func (u interfaceUsage) addVMs(host *capabilities.Host, object *vmObject) error {
+	vms, err := listNamespaceObjects(host, virtualMachineAPIVersion, virtualMachineKind, object.vm.Metadata.Namespace)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range vms {
+		other := virtualMachine{}
+		owned := ownedObject{}
+		if json.Unmarshal(item, &other) != nil || json.Unmarshal(item, &owned) != nil ||
+			owned.isOwnedBy(virtualMachinePoolKind) ||
+			(object.kind != virtualMachinePoolKind && other.Metadata == object.vm.Metadata) {
+			continue
+		}
+		u.add(&other, 1)
+	}
+
+	return nil
+}
+
+func (u interfaceUsage) addVMIs(host *capabilities.Host, object *vmObject) error {
+	vmis, err := listNamespaceObjects(
+		host, virtualMachineAPIVersion, virtualMachineInstanceKind, object.vm.Metadata.Namespace)
+	if err != nil {
+		return err
+	}
+
+	vmiKind := kubewardenProtocol.GroupVersionKind{Kind: virtualMachineInstanceKind}
+	for _, item := range vmis {
+		vmi, err := decodeVMObject(vmiKind, item)
+		if err != nil || vmi.ownedByVM ||
+			(object.kind == virtualMachineInstanceKind && vmi.vm.Metadata == object.vm.Metadata) {
+			continue
+		}
+		u.add(&vmi.vm, 1)
+	}
+
+	return nil
+}
+
+func (u interfaceUsage) addPools(host *capabilities.Host, object *vmObject) error {
+	pools, err := listNamespaceObjects(
+		host, virtualMachinePoolAPIVersion, virtualMachinePoolKind, object.vm.Metadata.Namespace)
+	if err != nil {
+		return err
+	}
+
+	poolKind := kubewardenProtocol.GroupVersionKind{Kind: virtualMachinePoolKind}
+	for _, item := range pools {
+		pool, err := decodeVMObject(poolKind, item)
+		if err != nil || (object.kind == virtualMachinePoolKind && pool.vm.Metadata == object.vm.Metadata) {
+			continue
+		}
+		u.add(&pool.vm, pool.replicas)
+	}
+
+	return nil
+}
+
+// listNamespaceObjects lists the objects of a kind in a namespace.
+func listNamespaceObjects(host *capabilities.Host, apiVersion, kind, namespace string) ([]json.RawMessage, error) {
+	kubeRequest := kubernetes.ListResourcesByNamespaceRequest{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Namespace:  namespace,
+	}
+
+	response, err := kubernetes.ListResourcesByNamespace(host, kubeRequest)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list %ss of namespace '%s': %w", kind, namespace, err)
+	}
+
+	list := virtualMachineList{}
+	err = json.Unmarshal(response, &list)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshall response into %ss: %w", kind, err)
+	}
+
+	return list.Items, nil
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getInterfacesVMObject returns a VM with interfaces nic-1 to nic-<count>, all connected to the network.
+func getInterfacesVMObject(vmName, namespace, network string, count int) virtualMachine {
+	vmObject := getVMObject(vmName, namespace, network)
+	vmObject.Spec.Template.Spec.Networks = []vmNetwork{}
+	for i := 1; i <= count; i++ {
+		name := fmt.Sprintf("nic-%d", i)
+		vmObject.Spec.Template.Spec.Networks = append(vmObject.Spec.Template.Spec.Networks,
+			vmNetwork{Name: name, Multus: multus{NetworkName: network}})
+		devices := &vmObject.Spec.Template.Spec.Domain.Devices
+		devices.Interfaces = append(devices.Interfaces, vmInterface{Name: name})
+	}
+	return vmObject
+}
+
+// getInterfacesPoolObject returns a pool whose VMs have interfaces nic-1 to nic-<count>, all connected to the network.
+func getInterfacesPoolObject(poolName, namespace, network string, count, replicas int) vmObject {
+	return vmObject{
+		kind:     virtualMachinePoolKind,
+		replicas: replicas,
+		vm:       getInterfacesVMObject(poolName, namespace, network, count),
+	}
+}
+
+func TestInterfaceLimitProblems(t *testing.T) {
+	settings := Settings{
+		NamespaceInterfaceLimits: []NamespaceInterfaceLimit{
+			{Namespace: "namespace-1", MaxInterfaces: 4, NetworkLimits: []NetworkInterfaceLimit{
+				{Network: "sriov-1", MaxInterfaces: 8},
+				{Network: "namespace-2/sriov-2", MaxInterfaces: 2},
+			}},
+			{Namespace: "Namespace-2", MaxInterfaces: 4},
+			{Namespace: "namespace-3"},
+			{Namespace: "namespace-4", MaxInterfaces: -1},
+			{Namespace: "namespace-5", NetworkLimits: []NetworkInterfaceLimit{
+				{Network: "Sriov-1", MaxInterfaces: 8},
+				{Network: "sriov-2"},
+			}},
+		},
+	}
+
+	assert.Equal(t, []string{
+		"namespaceInterfaceLimits[1]: invalid namespace 'Namespace-2'",
+		"namespaceInterfaceLimits[2]: a positive maxInterfaces or networkLimits must be specified",
+		"namespaceInterfaceLimits[3]: a positive maxInterfaces or networkLimits must be specified",
+		"namespaceInterfaceLimits[4].networkLimits[0]: network 'Sriov-1' has an invalid name 'Sriov-1'",
+		"namespaceInterfaceLimits[4].networkLimits[1]: maxInterfaces must be positive",
+	}, settings.interfaceLimitProblems())
+}
+
+func TestInterfaceLimitRejectionMaxInterfaces(t *testing.T) {
+	// the VirtualMachines are only listed for network limits
+	host := &capabilities.Host{
+		Client: &mocks.MockWapcClient{},
+	}
+
+	settings := Settings{
+		NamespaceInterfaceLimits: []NamespaceInterfaceLimit{
+			{Namespace: "namespace-1", MaxInterfaces: 2},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		count     int
+		rejection string
+	}{
+		{name: "within the limit", namespace: "namespace-1", count: 2},
+		{
+			name:      "over the limit",
+			namespace: "namespace-1",
+			count:     3,
+			rejection: "VM 'vm-1' has 3 interfaces, only 2 are allowed for namespace: 'namespace-1'",
+		},
+		{name: "unlimited namespace", namespace: "namespace-2", count: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object := vmObject{
+				kind:     virtualMachineKind,
+				replicas: 1,
+				vm:       getInterfacesVMObject("vm-1", tt.namespace, "network-1", tt.count),
+			}
+			rejection, err := interfaceLimitRejection(host, &settings, &object)
+			require.NoError(t, err)
+			assert.Equal(t, tt.rejection, rejection)
+		})
+	}
+}
+
+func TestInterfaceLimitRejectionNetworkLimits(t *testing.T) {
+	vmsInputPayload := `{"api_version":"kubevirt.io/v1","kind":"VirtualMachine","namespace":"namespace-1"}`
+	vmisInputPayload := `{"api_version":"kubevirt.io/v1","kind":"VirtualMachineInstance","namespace":"namespace-1"}`
+	poolsInputPayload := `{"api_version":"pool.kubevirt.io/v1alpha1","kind":"VirtualMachinePool",` +
+		`"namespace":"namespace-1"}`
+
+	marshal := func(vmObject virtualMachine) json.RawMessage {
+		item, err := json.Marshal(vmObject)
+		require.NoError(t, err)
+		return item
+	}
+
+	marshalPool := func(object vmObject) json.RawMessage {
+		pool := virtualMachinePool{
+			Metadata: object.vm.Metadata,
+			Spec:     vmPoolSpec{Replicas: &object.replicas, VirtualMachineTemplate: vmSource{Spec: object.vm.Spec}},
+		}
+		item, err := json.Marshal(pool)
+		require.NoError(t, err)
+		return item
+	}
+
+	marshalVMI := func(vmObject virtualMachine) json.RawMessage {
+		vmi := virtualMachineInstance{Metadata: vmObject.Metadata, Spec: vmObject.Spec.Template.Spec}
+		item, err := json.Marshal(vmi)
+		require.NoError(t, err)
+		return item
+	}
+
+	marshalOwned := func(object json.RawMessage, ownerKind, ownerName string) json.RawMessage {
+		item := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(object, &item))
+		metadata, _ := item["metadata"].(map[string]interface{})
+		metadata["ownerReferences"] = []ownerReference{{Kind: ownerKind, Name: ownerName}}
+		owned, err := json.Marshal(item)
+		require.NoError(t, err)
+		return owned
+	}
+
+	marshalPoolVM := func(vmObject virtualMachine, poolName string) json.RawMessage {
+		return marshalOwned(marshal(vmObject), virtualMachinePoolKind, poolName)
+	}
+
+	settings := Settings{
+		NamespaceInterfaceLimits: []NamespaceInterfaceLimit{
+			{Namespace: "namespace-1", NetworkLimits: []NetworkInterfaceLimit{
+				{Network: "sriov-1", MaxInterfaces: 4},
+			}},
+		},
+	}
+
+	vm := vmObject{
+		kind:     virtualMachineKind,
+		replicas: 1,
+		vm:       getInterfacesVMObject("vm-1", "namespace-1", "sriov-1", 2),
+	}
+
+	tests := []struct {
+		name          string
+		object        vmObject
+		vms           []json.RawMessage
+		vmis          []json.RawMessage
+		pools         []json.RawMessage
+		responseError error
+		rejection     string
+		expectError   bool
+	}{
+		{
+			name:   "within the limit",
+			object: vm,
+			vms: []json.RawMessage{
+				marshal(getInterfacesVMObject("vm-2", "namespace-1", "sriov-1", 2)),
+			},
+		},
+		{
+			name:   "previous version of the VM being updated",
+			object: vm,
+			vms: []json.RawMessage{
+				marshal(getInterfacesVMObject("vm-1", "namespace-1", "sriov-1", 2)),
+				marshal(getInterfacesVMObject("vm-2", "namespace-1", "namespace-1/sriov-1", 2)),
+			},
+		},
+		{
+			name:   "interfaces on other networks",
+			object: vm,
+			vms: []json.RawMessage{
+				marshal(getInterfacesVMObject("vm-2", "namespace-1", "sriov-2", 4)),
+			},
+		},
+		{
+			name:   "over the limit",
+			object: vm,
+			vms: []json.RawMessage{
+				json.RawMessage(`{"metadata":"broken"}`),
+				marshal(getInterfacesVMObject("vm-2", "namespace-1", "sriov-1", 2)),
+				marshal(getInterfacesVMObject("vm-3", "namespace-1", "namespace-1/sriov-1", 1)),
+			},
+			rejection: "Network 'namespace-1/sriov-1' has 3 of 4 interfaces in use in namespace: 'namespace-1', " +
+				"the VirtualMachine cannot add 2",
+		},
+		{
+			name:   "VMs of a pool are counted by the pool",
+			object: vm,
+			vms: []json.RawMessage{
+				marshalPoolVM(getInterfacesVMObject("pool-1-0", "namespace-1", "sriov-1", 2), "pool-1"),
+			},
+			pools: []json.RawMessage{
+				json.RawMessage(`{"metadata":"broken"}`),
+				marshalPool(getInterfacesPoolObject("pool-1", "namespace-1", "sriov-1", 2, 1)),
+			},
+		},
+		{
+			name:   "pool over the limit with its replicas",
+			object: vm,
+			pools: []json.RawMessage{
+				marshalPool(getInterfacesPoolObject("pool-1", "namespace-1", "sriov-1", 1, 3)),
+			},
+			rejection: "Network 'namespace-1/sriov-1' has 3 of 4 interfaces in use in namespace: 'namespace-1', " +
+				"the VirtualMachine cannot add 2",
+		},
+		{
+			name:   "pool adds its interfaces for every replica",
+			object: getInterfacesPoolObject("pool-1", "namespace-1", "sriov-1", 2, 2),
+			vms: []json.RawMessage{
+				marshal(getInterfacesVMObject("vm-2", "namespace-1", "sriov-1", 1)),
+			},
+			rejection: "Network 'namespace-1/sriov-1' has 1 of 4 interfaces in use in namespace: 'namespace-1', " +
+				"the VirtualMachinePool cannot add 4",
+		},
+		{
+			name:   "previous version of the pool being updated",
+			object: getInterfacesPoolObject("pool-1", "namespace-1", "sriov-1", 1, 2),
+			vms: []json.RawMessage{
+				marshalPoolVM(getInterfacesVMObject("pool-1-0", "namespace-1", "sriov-1", 1), "pool-1"),
+				marshalPoolVM(getInterfacesVMObject("pool-1-1", "namespace-1", "sriov-1", 1), "pool-1"),
+				marshal(getInterfacesVMObject("pool-1", "namespace-1", "sriov-1", 2)),
+			},
+			pools: []json.RawMessage{
+				marshalPool(getInterfacesPoolObject("pool-1", "namespace-1", "sriov-1", 1, 2)),
+			},
+		},
+		{
+			name:   "standalone VMIs are counted",
+			object: vm,
+			vmis: []json.RawMessage{
+				json.RawMessage(`{"metadata":"broken"}`),
+				marshalVMI(getInterfacesVMObject("vmi-1", "namespace-1", "sriov-1", 2)),
+				marshalVMI(getInterfacesVMObject("vmi-2", "namespace-1", "sriov-1", 1)),
+			},
+			rejection: "Network 'namespace-1/sriov-1' has 3 of 4 interfaces in use in namespace: 'namespace-1', " +
+				"the VirtualMachine cannot add 2",
+		},
+		{
+			name:   "VMIs of a VM are counted by the VM",
+			object: vm,
+			vms: []json.RawMessage{
+				marshal(getInterfacesVMObject("vm-2", "namespace-1", "sriov-1", 2)),
+			},
+			vmis: []json.RawMessage{
+				marshalOwned(marshalVMI(getInterfacesVMObject("vm-2", "namespace-1", "sriov-1", 2)),
+					virtualMachineKind, "vm-2"),
+			},
+		},
+		{
+			name: "previous version of the standalone VMI being updated",
+			object: vmObject{
+				kind:     virtualMachineInstanceKind,
+				replicas: 1,
+				vm:       getInterfacesVMObject("vmi-1", "namespace-1", "sriov-1", 2),
+			},
+			vmis: []json.RawMessage{
+				marshalVMI(getInterfacesVMObject("vmi-1", "namespace-1", "sriov-1", 2)),
+				marshalVMI(getInterfacesVMObject("vmi-2", "namespace-1", "sriov-1", 2)),
+			},
+		},
+		{
+			name:          "list request failed",
+			object:        vm,
+			responseError: assert.AnError,
+			expectError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vmsResponse, err := json.Marshal(map[string]interface{}{"items": tt.vms})
+			require.NoError(t, err)
+			vmisResponse, err := json.Marshal(map[string]interface{}{"items": tt.vmis})
+			require.NoError(t, err)
+			poolsResponse, err := json.Marshal(map[string]interface{}{"items": tt.pools})
+			require.NoError(t, err)
+
+			mockWapcClient := &mocks.MockWapcClient{}
+			mockWapcClient.
+				EXPECT().
+				HostCall("kubewarden", "kubernetes", "list_resources_by_namespace", []byte(vmsInputPayload)).
+				Return(vmsResponse, tt.responseError).
+				Times(1)
+			mockWapcClient.
+				EXPECT().
+				HostCall("kubewarden", "kubernetes", "list_resources_by_namespace", []byte(vmisInputPayload)).
+				Return(vmisResponse, nil).
+				Maybe()
+			mockWapcClient.
+				EXPECT().
+				HostCall("kubewarden", "kubernetes", "list_resources_by_namespace", []byte(poolsInputPayload)).
+				Return(poolsResponse, nil).
+				Maybe()
+
+			host := &capabilities.Host{
+				Client: mockWapcClient,
+			}
+
+			rejection, err := interfaceLimitRejection(host, &settings, &tt.object)
+			if tt.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.rejection, rejection)
+		})
+	}
+}
+
+func TestInterfaceLimitRejectionTemplateVersion(t *testing.T) {
+	// a template version runs no VM, so nothing is listed
+	host := &capabilities.Host{
+		Client: &mocks.MockWapcClient{},
+	}
+
+	settings := Settings{
+		NamespaceInterfaceLimits: []NamespaceInterfaceLimit{
+			{Namespace: "namespace-1", NetworkLimits: []NetworkInterfaceLimit{
+				{Network: "sriov-1", MaxInterfaces: 4},
+			}},
+		},
+	}
+
+	object := vmObject{
+		kind: virtualMachineTemplateVersionKind,
+		vm:   getInterfacesVMObject("template-1", "namespace-1", "sriov-1", 5),
+	}
+	rejection, err := interfaceLimitRejection(host, &settings, &object)
+	require.NoError(t, err)
+	assert.Empty(t, rejection)
+}
+
+func TestInterfaceLimitRejectionOwnedVMI(t *testing.T) {
+	// the VirtualMachine of the VMI counts its interfaces, so nothing is listed
+	host := &capabilities.Host{
+		Client: &mocks.MockWapcClient{},
+	}
+
+	settings := Settings{
+		NamespaceInterfaceLimits: []NamespaceInterfaceLimit{
+			{Namespace: "namespace-1", NetworkLimits: []NetworkInterfaceLimit{
+				{Network: "sriov-1", MaxInterfaces: 4},
+			}},
+		},
+	}
+
+	object := vmObject{
+		kind:      virtualMachineInstanceKind,
+		replicas:  1,
+		ownedByVM: true,
+		vm:        getInterfacesVMObject("vm-1", "namespace-1", "sriov-1", 5),
+	}
+	rejection, err := interfaceLimitRejection(host, &settings, &object)
+	require.NoError(t, err)
+	assert.Empty(t, rejection)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+)
+
+const (
+	virtualMachineAPIVersion = "kubevirt.io/v1"
+	virtualMachineKind       = "VirtualMachine"
+
+	macAddressLength = 6
+)
+
+// NamespaceMACPrefixes limits the MAC addresses of the VM interfaces of a namespace.
+type NamespaceMACPrefixes struct {
+	Namespace string `json:"namespace"`
+	// Prefixes are the leading bytes of the MAC addresses, e.g. the OUI "52:54:00", or "52:54:00:10".
+	Prefixes []string `json:"prefixes"`
+}
+
+// parseMACPrefix parses 1 to 6 bytes of a MAC address, separated by ':'.
+func parseMACPrefix(value string) ([]byte, error) {
+	prefix := []byte{}
+	for _, part := range strings.Split(value, ":") {
+		b, err := hex.DecodeString(part)
+		if err != nil || len(b) != 1 {
+			return nil, fmt.Errorf("'%s' is not a MAC address prefix", value)
+		}
+		prefix = append(prefix, b[0])
+	}
+
+	if len(prefix) > macAddressLength {
+		return nil, fmt.Errorf("'%s' is longer than a MAC address", value)
+	}
+
+	return prefix, nil
+}
+
+// macPrefixProblems ensures that every namespace has valid prefixes, and is listed once.
+func (s *Settings) macPrefixProblems() []string {
+	problems := []string{}
+	seen := map[string]int{}
+	for i, binding := range s.NamespaceMACPrefixes {
+		if binding.Namespace == "" || len(binding.Prefixes) == 0 {
+			problems = append(problems,
+				fmt.Sprintf("namespaceMACPrefixes[%d]: namespace and prefixes must be specified", i))
+			continue
+		}
+
+		if first, ok := seen[binding.Namespace]; ok {
+			problems = append(problems,
+				fmt.Sprintf("namespaceMACPrefixes[%d]: duplicate of namespaceMACPrefixes[%d]", i, first))
+			continue
+		}
+		seen[binding.Namespace] = i
+
+		for _, value := range binding.Prefixes {
+			if _, err := parseMACPrefix(value); err != nil {
+				problems = append(problems, fmt.Sprintf("namespaceMACPrefixes[%d]: %v", i, err))
+			}
+		}
+	}
+
+	return problems
+}
+
+// isMACAddressAllowed verifies if a namespace can use a MAC address, namespaces without prefixes can use any.
+func (s *Settings) isMACAddressAllowed(namespace string, macAddress net.HardwareAddr) bool {
+	for _, binding := range s.NamespaceMACPrefixes {
+		if binding.Namespace != namespace {
+			continue
+		}
+
+		return slices.ContainsFunc(binding.Prefixes, func(value string) bool {
+			// invalid prefixes are rejected with the settings
+			prefix, err := parseMACPrefix(value)
+			return err == nil && bytes.HasPrefix(macAddress, prefix)
+		})
+	}
+
+	return true
+}
+
+// parseMACAddress parses the MAC address of an interface, it must be a 48 bit MAC address.
+func (i *vmInterface) parseMACAddress() (net.HardwareAddr, error) {
+	macAddress, err := net.ParseMAC(i.MacAddress)
+	if err != nil || len(macAddress) != macAddressLength {
+		return nil, fmt.Errorf("interface '%s' has an invalid MAC address '%s'", i.Name, i.MacAddress)
+	}
+
+	return macAddress, nil
+}
+
+// vmMACAddress is the MAC address of an interface connected to a multus network.
+type vmMACAddress struct {
+	interfaceName string
+	// network is "namespace/name"
+	network    string
+	macAddress string
+}
+
+// macAddresses returns the MAC addresses set on the interfaces of the multus networks of the VM.
+// Interfaces with an invalid MAC address or network are skipped.
+func (v *virtualMachine) macAddresses() []vmMACAddress {
+	networks := map[string]string{}
+	for _, network := range v.Spec.Template.Spec.Networks {
+		if network.Pod != nil || network.Multus.NetworkName == "" {
+			continue
+		}
+
+		networkName, err := normalizeNetworkName(network.Multus.NetworkName, v.Metadata.Namespace)
+		if err == nil {
+			networks[network.Name] = networkName
+		}
+	}
+
+	macAddresses := []vmMACAddress{}
+	for _, vmInterface := range v.Spec.Template.Spec.Domain.Devices.Interfaces {
+		network, ok := networks[vmInterface.Name]
+		if !ok || vmInterface.MacAddress == "" {
+			continue
+		}
+
+		macAddress, err := vmInterface.parseMACAddress()
+		if err == nil {
+			macAddresses = append(macAddresses, vmMACAddress{
+				interfaceName: vmInterface.Name,
+				network:       network,
+				macAddress:    macAddress.String(),
+			})
+		}
+	}
+
+	return macAddresses
+}
+
+type virtualMachineList struct {
+	Items []json.RawMessage `json:"items"`
+}
+
+// macAddressConflictRejection rejects a VirtualMachine or a VirtualMachineInstance using a MAC address that
+// another VirtualMachine already uses on the same multus network, it lists every VirtualMachine of the cluster.
+// VirtualMachines that cannot be decoded are skipped.
+//
+// The VMs of a pool are checked when the pool creates them, so a pool is only rejected when its template sets a
+// MAC address for more than one replica. A template version runs no VM, so it isn't checked.
+// It returns why the object is rejected, or an empty string when its MAC addresses are unique.
+func macAddressConflictRejection(host *capabilities.Host, object *vmObject) (string, error) {
+	vm := &object.vm
+	macAddresses := vm.macAddresses()
+	if len(macAddresses) == 0 {
+		return "", nil
+	}
+
+	switch object.kind {
+	case virtualMachinePoolKind:
+		if object.replicas > 1 {
+			return fmt.Sprintf(
+				"MAC address %s of interface '%s' cannot be used by the %d replicas of VirtualMachinePool '%s/%s'",
+				macAddresses[0].macAddress, macAddresses[0].interfaceName, object.replicas,
+				vm.Metadata.Namespace, vm.Metadata.Name), nil
+		}
+		return "", nil
+	case virtualMachineTemplateVersionKind:
+		return "", nil
+	}
+
+	kubeRequest := kubernetes.ListAllResourcesRequest{
+		APIVersion: virtualMachineAPIVersion,
+		Kind:       virtualMachineKind,
+	}
+
+	response, err := kubernetes.ListResources(host, kubeRequest)
+	if err != nil {
+		return "", fmt.Errorf("cannot list VirtualMachines: %w", err)
+	}
+
+	list := virtualMachineList{}
+	err = json.Unmarshal(response, &list)
+	if err != nil {
+		return "", fmt.Errorf("cannot unmarshall response into VirtualMachines: %w", err)
+	}
+
+	for _, item := range list.Items {
+		other := virtualMachine{}
+		if json.Unmarshal(item, &other) != nil || other.Metadata == vm.Metadata {
+			continue
+		}
+
+		otherMACAddresses := other.macAddresses()
+		for _, macAddress := range macAddresses {
+			if slices.ContainsFunc(otherMACAddresses, func(otherMACAddress vmMACAddress) bool {
+				return otherMACAddress.network == macAddress.network &&
+					otherMACAddress.macAddress == macAddress.macAddress
+			}) {
+				return fmt.Sprintf(
+					"MAC address %s of interface '%s' is already used on network '%s' by VirtualMachine '%s/%s'",
+					macAddress.macAddress, macAddress.interfaceName, macAddress.network,
+					other.Metadata.Namespace, other.Metadata.Name), nil
+			}
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getMACAddressVMObject(vmName, namespace, network, macAddress string) virtualMachine {
+	vmObject := getVMObject(vmName, namespace, network)
+	vmObject.Spec.Template.Spec.Networks[0].Name = "nic-1"
+	vmObject.Spec.Template.Spec.Domain.Devices.Interfaces = []vmInterface{
+		{Name: "nic-1", MacAddress: macAddress},
+	}
+	return vmObject
+}
+
+func TestMACPrefixProblems(t *testing.T) {
+	settings := Settings{
+		NamespaceMACPrefixes: []NamespaceMACPrefixes{
+			{Namespace: "namespace-1", Prefixes: []string{"52:54:00", "02:00:00:10"}},
+			{Namespace: "namespace-2"},
+			{Namespace: "namespace-3", Prefixes: []string{"52:54:0", "52-54-00", "52:54:00:00:00:00:00"}},
+			{Namespace: "namespace-1", Prefixes: []string{"02:00:00:20"}},
+		},
+	}
+
+	assert.Equal(t, []string{
+		"namespaceMACPrefixes[1]: namespace and prefixes must be specified",
+		"namespaceMACPrefixes[2]: '52:54:0' is not a MAC address prefix",
+		"namespaceMACPrefixes[2]: '52-54-00' is not a MAC address prefix",
+		"namespaceMACPrefixes[2]: '52:54:00:00:00:00:00' is longer than a MAC address",
+		"namespaceMACPrefixes[3]: duplicate of namespaceMACPrefixes[0]",
+	}, settings.macPrefixProblems())
+}
+
+func TestIsMACAddressAllowed(t *testing.T) {
+	settings := Settings{
+		NamespaceMACPrefixes: []NamespaceMACPrefixes{
+			{Namespace: "namespace-1", Prefixes: []string{"52:54:00", "02:00:00:10"}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		namespace  string
+		macAddress string
+		allowed    bool
+	}{
+		{name: "OUI of the namespace", namespace: "namespace-1", macAddress: "52:54:00:12:34:56", allowed: true},
+		{name: "longer prefix", namespace: "namespace-1", macAddress: "02:00:00:10:00:01", allowed: true},
+		{name: "uppercase MAC address", namespace: "namespace-1", macAddress: "52:54:00:AB:CD:EF", allowed: true},
+		{name: "other prefix", namespace: "namespace-1", macAddress: "02:00:00:11:00:01"},
+		{name: "unrestricted namespace", namespace: "namespace-2", macAddress: "02:00:00:11:00:01", allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			macAddress, err := net.ParseMAC(tt.macAddress)
+			require.NoError(t, err)
+			assert.Equal(t, tt.allowed, settings.isMACAddressAllowed(tt.namespace, macAddress))
+		})
+	}
+}
+
+func TestInterfaceRejectionMACAddress(t *testing.T) {
+	settings := Settings{
+		NamespaceMACPrefixes: []NamespaceMACPrefixes{
+			{Namespace: "namespace-1", Prefixes: []string{"52:54:00"}},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		macAddress    string
+		rejection     string
+		expectedError string
+	}{
+		{name: "assigned by KubeVirt"},
+		{name: "allowed prefix", macAddress: "52:54:00:12:34:56"},
+		{
+			name:       "other prefix",
+			macAddress: "02:00:00:12:34:56",
+			rejection:  "MAC address 02:00:00:12:34:56 of interface 'nic-1' is not allowed for namespace: 'namespace-1'",
+		},
+		{
+			name:          "invalid MAC address",
+			macAddress:    "52:54:00:12:34",
+			expectedError: "interface 'nic-1' has an invalid MAC address '52:54:00:12:34'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vmObject := getMACAddressVMObject("vm-1", "namespace-1", "network-1", tt.macAddress)
+
+			rejection, err := interfaceRejection(&settings, "namespace-1", &vmObject.Spec.Template.Spec)
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.rejection, rejection)
+		})
+	}
+}
+
+func TestMACAddressConflictRejection(t *testing.T) {
+	expectedInputPayload := `{"api_version":"kubevirt.io/v1","kind":"VirtualMachine"}`
+
+	marshal := func(vmObject virtualMachine) json.RawMessage {
+		item, err := json.Marshal(vmObject)
+		require.NoError(t, err)
+		return item
+	}
+
+	tests := []struct {
+		name          string
+		items         []json.RawMessage
+		responseError error
+		rejection     string
+		expectError   bool
+	}{
+		{
+			name: "unique MAC address",
+			items: []json.RawMessage{
+				marshal(getMACAddressVMObject("vm-2", "namespace-2", "namespace-1/network-1", "52:54:00:00:00:02")),
+			},
+		},
+		{
+			name: "MAC address of the VM being updated",
+			items: []json.RawMessage{
+				marshal(getMACAddressVMObject("vm-1", "namespace-1", "network-1", "52:54:00:00:00:01")),
+			},
+		},
+		{
+			name: "MAC address used on another network",
+			items: []json.RawMessage{
+				marshal(getMACAddressVMObject("vm-2", "namespace-2", "network-1", "52:54:00:00:00:01")),
+			},
+		},
+		{
+			name: "MAC address used on the same network",
+			items: []json.RawMessage{
+				json.RawMessage(`{"metadata":"broken"}`),
+				marshal(getMACAddressVMObject("vm-2", "namespace-2", "namespace-1/network-1", "52:54:00:00:00:01")),
+			},
+			rejection: "MAC address 52:54:00:00:00:01 of interface 'nic-1' is already used on network " +
+				"'namespace-1/network-1' by VirtualMachine 'namespace-2/vm-2'",
+		},
+		{
+			name:          "list request failed",
+			responseError: assert.AnError,
+			expectError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := json.Marshal(map[string]interface{}{"items": tt.items})
+			require.NoError(t, err)
+
+			mockWapcClient := &mocks.MockWapcClient{}
+			mockWapcClient.
+				EXPECT().
+				HostCall("kubewarden", "kubernetes", "list_resources_all", []byte(expectedInputPayload)).
+				Return(response, tt.responseError).
+				Times(1)
+
+			host := &capabilities.Host{
+				Client: mockWapcClient,
+			}
+
+			object := vmObject{
+				kind:     virtualMachineKind,
+				replicas: 1,
+				vm:       getMACAddressVMObject("vm-1", "namespace-1", "network-1", "52:54:00:00:00:01"),
+			}
+			rejection, err := macAddressConflictRejection(host, &object)
+			if tt.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.rejection, rejection)
+		})
+	}
+}
+
+func TestMACAddressConflictRejectionWithoutMACAddresses(t *testing.T) {
+	// the VirtualMachines are only listed when the VM sets MAC addresses
+	host := &capabilities.Host{
+		Client: &mocks.MockWapcClient{},
+	}
+
+	object := vmObject{
+		kind:     virtualMachineKind,
+		replicas: 1,
+		vm:       getMACAddressVMObject("vm-1", "namespace-1", "network-1", ""),
+	}
+	rejection, err := macAddressConflictRejection(host, &object)
+	require.NoError(t, err)
+	assert.Empty(t, rejection)
+}
+
+func TestMACAddressConflictRejectionByKind(t *testing.T) {
+	// pools and template versions aren't compared with the VirtualMachines of the cluster
+	host := &capabilities.Host{
+		Client: &mocks.MockWapcClient{},
+	}
+
+	tests := []struct {
+		name      string
+		kind      string
+		replicas  int
+		rejection string
+	}{
+		{name: "pool of one replica", kind: virtualMachinePoolKind, replicas: 1},
+		{
+			name:     "pool of many replicas",
+			kind:     virtualMachinePoolKind,
+			replicas: 3,
+			rejection: "MAC address 52:54:00:00:00:01 of interface 'nic-1' cannot be used by the 3 replicas of " +
+				"VirtualMachinePool 'namespace-1/pool-1'",
+		},
+		{name: "template version", kind: virtualMachineTemplateVersionKind},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object := vmObject{
+				kind:     tt.kind,
+				replicas: tt.replicas,
+				vm:       getMACAddressVMObject("pool-1", "namespace-1", "network-1", "52:54:00:00:00:01"),
+			}
+			rejection, err := macAddressConflictRejection(host, &object)
+			require.NoError(t, err)
+			assert.Equal(t, tt.rejection, rejection)
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+)
+
+const (
+	networkAttachmentDefinitionAPIVersion = "k8s.cni.cncf.io/v1"
+	networkAttachmentDefinitionKind       = "NetworkAttachmentDefinition"
+
+	clusterNetworkLabel = "network.harvesterhci.io/clusternetwork"
+	// Harvester names the bridge of a cluster network after it, e.g. "mgmt-br" for "mgmt".
+	bridgeSuffix = "-br"
+)
+
+// cniPlugin is the configuration of a single CNI plugin, with the fields that carry a VLAN or an underlay.
+type cniPlugin struct {
+	Type      string           `json:"type"`
+	Bridge    string           `json:"bridge"`
+	VLAN      int              `json:"vlan"`
+	VLANTrunk []vlanTrunkEntry `json:"vlanTrunk"`
+	// Master is the parent interface of macvlan and ipvlan, e.g. "eth0.300".
+	Master string `json:"master"`
+	// Provider is the kube-ovn provider of the network.
+	Provider string `json:"provider"`
+}
+
+// cniConfig is either a single plugin configuration, or a configuration list with its plugins in Plugins.
+type cniConfig struct {
+	cniPlugin
+	Plugins []cniPlugin `json:"plugins"`
+}
+
+// UnmarshalJSON decodes the config from a JSON string, which is how it's usually written, or a JSON object.
+func (c *cniConfig) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var jsonString string
+		if err := json.Unmarshal(data, &jsonString); err != nil {
+			return err
+		}
+		data = []byte(jsonString)
+	}
+
+	// Create a new type to avoid infinite recursion
+	type C cniConfig
+	return json.Unmarshal(data, (*C)(c))
+}
+
+type nadMetadata struct {
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels"`
+}
+
+type nadSpec struct {
+	Config cniConfig `json:"config"`
+}
+
+type networkAttachmentDefinition struct {
+	Metadata nadMetadata `json:"metadata"`
+	Spec     nadSpec     `json:"spec"`
+}
+
+// vlanNetwork is a VLAN on a Harvester cluster network, VLAN 0 is the untagged network.
+type vlanNetwork struct {
+	clusterNetwork string
+	vlan           int
+}
+
+// getNetworkAttachmentDefinition gets the NetworkAttachmentDefinition of a "namespace/name" network.
+func getNetworkAttachmentDefinition(host *capabilities.Host, networkName string) (networkAttachmentDefinition, error) {
+	namespace, name, _ := strings.Cut(networkName, "/")
+	kubeRequest := kubernetes.GetResourceRequest{
+		APIVersion: networkAttachmentDefinitionAPIVersion,
+		Kind:       networkAttachmentDefinitionKind,
+		Name:       name,
+		Namespace:  &namespace,
+	}
+
+	response, err := kubernetes.GetResource(host, kubeRequest)
+	if err != nil {
+		return networkAttachmentDefinition{},
+			fmt.Errorf("cannot get NetworkAttachmentDefinition '%s': %w", networkName, err)
+	}
+
+	nad := networkAttachmentDefinition{}
+	err = json.Unmarshal(response, &nad)
+	if err != nil {
+		return networkAttachmentDefinition{},
+			fmt.Errorf("cannot decode NetworkAttachmentDefinition '%s': %w", networkName, err)
+	}
+
+	return nad, nil
+}
+
+// vlanNetworks returns the networks of every plugin, worked out by the extractor of its CNI type, like
+// harvester-restricted-network does. The cluster network label is the default cluster network.
+// A config without a VLAN is untagged.
+func (n *networkAttachmentDefinition) vlanNetworks() ([]vlanNetwork, error) {
+	plugins := n.Spec.Config.Plugins
+	if n.Spec.Config.Type != "" || len(plugins) == 0 {
+		plugins = append([]cniPlugin{n.Spec.Config.cniPlugin}, plugins...)
+	}
+
+	networks := []vlanNetwork{}
+	seen := map[vlanNetwork]struct{}{}
+	extractors := newNetworkExtractors()
+	defaultClusterNetwork := n.Metadata.Labels[clusterNetworkLabel]
+
+	for _, plugin := range plugins {
+		extract, ok := extractors[plugin.Type]
+		if !ok {
+			extract = extractBridgeNetworks
+		}
+
+		pluginNetworks, err := extract(&plugin, defaultClusterNetwork)
+		if err != nil {
+			return nil, fmt.Errorf("invalid '%s' plugin: %w", plugin.Type, err)
+		}
+
+		for _, network := range pluginNetworks {
+			if _, ok := seen[network]; !ok {
+				seen[network] = struct{}{}
+				networks = append(networks, network)
+			}
+		}
+	}
+
+	if len(networks) == 0 {
+		networks = append(networks,
+			vlanNetwork{clusterNetwork: bridgeClusterNetwork(&plugins[0], defaultClusterNetwork), vlan: untaggedVLAN})
+	}
+
+	return networks, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVLANNetworks(t *testing.T) {
+	tests := []struct {
+		name          string
+		nad           string
+		networks      []vlanNetwork
+		expectedError string
+	}{
+		{
+			name:     "config string",
+			nad:      `{"spec":{"config":"{\"type\":\"bridge\",\"bridge\":\"mgmt-br\",\"vlan\":42}"}}`,
+			networks: []vlanNetwork{{clusterNetwork: "mgmt", vlan: 42}},
+		},
+		{
+			name: "config list",
+			nad: `{"spec":{"config":{"plugins":[{"type":"bridge","bridge":"data-br","vlan":42},` +
+				`{"type":"tuning"}]}}}`,
+			networks: []vlanNetwork{{clusterNetwork: "data", vlan: 42}},
+		},
+		{
+			name: "cluster network label",
+			nad: `{"metadata":{"labels":{"network.harvesterhci.io/clusternetwork":"data"}},` +
+				`"spec":{"config":{"type":"bridge","vlan":42}}}`,
+			networks: []vlanNetwork{{clusterNetwork: "data", vlan: 42}},
+		},
+		{
+			name: "VLAN trunk",
+			nad: `{"spec":{"config":{"type":"bridge","bridge":"data-br",` +
+				`"vlanTrunk":[{"id":42},{"minID":100,"maxID":101}]}}}`,
+			networks: []vlanNetwork{
+				{clusterNetwork: "data", vlan: 42},
+				{clusterNetwork: "data", vlan: 100},
+				{clusterNetwork: "data", vlan: 101},
+			},
+		},
+		{
+			name:     "untagged",
+			nad:      `{"spec":{"config":{"type":"bridge","bridge":"mgmt-br"}}}`,
+			networks: []vlanNetwork{{clusterNetwork: "mgmt", vlan: 0}},
+		},
+		{
+			name:     "bridge without the Harvester suffix",
+			nad:      `{"spec":{"config":{"type":"bridge","bridge":"storage","vlan":42}}}`,
+			networks: []vlanNetwork{{clusterNetwork: "storage", vlan: 42}},
+		},
+		{
+			name: "same VLAN in two plugins",
+			nad: `{"spec":{"config":{"plugins":[{"type":"bridge","bridge":"data-br","vlan":42},` +
+				`{"type":"bridge","bridge":"data-br","vlanTrunk":[{"id":42}]}]}}}`,
+			networks: []vlanNetwork{{clusterNetwork: "data", vlan: 42}},
+		},
+		{
+			name: "SR-IOV VLAN on the cluster network label",
+			nad: `{"metadata":{"labels":{"network.harvesterhci.io/clusternetwork":"sriov"}},` +
+				`"spec":{"config":{"type":"sriov","vlan":300}}}`,
+			networks: []vlanNetwork{{clusterNetwork: "sriov", vlan: 300}},
+		},
+		{
+			name: "untagged SR-IOV",
+			nad: `{"metadata":{"labels":{"network.harvesterhci.io/clusternetwork":"sriov"}},` +
+				`"spec":{"config":{"type":"sriov"}}}`,
+			networks: []vlanNetwork{{clusterNetwork: "sriov", vlan: 0}},
+		},
+		{
+			name: "macvlan master VLAN interface",
+			nad: `{"metadata":{"labels":{"network.harvesterhci.io/clusternetwork":"mgmt"}},` +
+				`"spec":{"config":{"type":"macvlan","master":"eth0.300"}}}`,
+			networks: []vlanNetwork{{clusterNetwork: "mgmt", vlan: 300}},
+		},
+		{
+			name:     "ipvlan master on a Harvester bridge",
+			nad:      `{"spec":{"config":{"type":"ipvlan","master":"data-br.300"}}}`,
+			networks: []vlanNetwork{{clusterNetwork: "data", vlan: 300}},
+		},
+		{
+			name: "untagged macvlan master",
+			nad: `{"metadata":{"labels":{"network.harvesterhci.io/clusternetwork":"mgmt"}},` +
+				`"spec":{"config":{"type":"macvlan","master":"eth0"}}}`,
+			networks: []vlanNetwork{{clusterNetwork: "mgmt", vlan: 0}},
+		},
+		{
+			name:     "kube-ovn provider",
+			nad:      `{"spec":{"config":{"type":"kube-ovn","provider":"vpc-1.default.ovn"}}}`,
+			networks: []vlanNetwork{{clusterNetwork: "vpc-1.default.ovn", vlan: 0}},
+		},
+		{
+			name:          "macvlan master that isn't a VLAN interface",
+			nad:           `{"spec":{"config":{"type":"macvlan","master":"eth0.vlan"}}}`,
+			expectedError: "invalid 'macvlan' plugin: master 'eth0.vlan' is not a VLAN interface",
+		},
+		{
+			name:          "macvlan master VLAN out of range",
+			nad:           `{"spec":{"config":{"type":"macvlan","master":"eth0.5000"}}}`,
+			expectedError: "invalid 'macvlan' plugin: master 'eth0.5000' has a VLAN out of range 1-4094",
+		},
+		{
+			name:          "SR-IOV VLAN out of range",
+			nad:           `{"spec":{"config":{"type":"sriov","vlan":5000}}}`,
+			expectedError: "invalid 'sriov' plugin: vlan 5000 is out of range 1-4094",
+		},
+		{
+			name: "VLAN trunk out of range",
+			nad: `{"spec":{"config":{"type":"bridge","bridge":"mgmt-br",` +
+				`"vlanTrunk":[{"minID":4000,"maxID":4095}]}}}`,
+			expectedError: "invalid 'bridge' plugin: invalid vlanTrunk entry: VLANs 4000-4095 are out of range 1-4094",
+		},
+		{
+			name:          "VLAN out of range",
+			nad:           `{"spec":{"config":{"type":"bridge","bridge":"mgmt-br","vlan":4095}}}`,
+			expectedError: "invalid 'bridge' plugin: vlan 4095 is out of range 1-4094",
+		},
+		{
+			name:          "incomplete VLAN trunk",
+			nad:           `{"spec":{"config":{"type":"bridge","bridge":"mgmt-br","vlanTrunk":[{"minID":100}]}}}`,
+			expectedError: "invalid 'bridge' plugin: a vlanTrunk entry needs either an id, or a minID and a maxID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nad := networkAttachmentDefinition{}
+			require.NoError(t, json.Unmarshal([]byte(tt.nad), &nad))
+
+			networks, err := nad.vlanNetworks()
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.networks, networks)
+		})
+	}
+}
+
+// sharedNetworkCase is a case of test_data/network_attachment_definitions.json, which harvester-restricted-network
+// reads the same networks from.
+type sharedNetworkCase struct {
+	Name     string            `json:"name"`
+	Labels   map[string]string `json:"labels"`
+	Config   string            `json:"config"`
+	Networks []struct {
+		ClusterNetwork string `json:"clusterNetwork"`
+		VLAN           int    `json:"vlan"`
+	} `json:"networks"`
+	Invalid bool `json:"invalid"`
+}
+
+// item returns the NetworkAttachmentDefinition of the case.
+func (c *sharedNetworkCase) item(t *testing.T) json.RawMessage {
+	t.Helper()
+
+	item, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "network-1", "namespace": "namespace-1", "labels": c.Labels},
+		"spec":     map[string]string{"config": c.Config},
+	})
+	require.NoError(t, err)
+
+	return item
+}
+
+func TestSharedVLANNetworks(t *testing.T) {
+	data, err := os.ReadFile("../test_data/network_attachment_definitions.json")
+	require.NoError(t, err)
+
+	cases := []sharedNetworkCase{}
+	require.NoError(t, json.Unmarshal(data, &cases))
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			nad := networkAttachmentDefinition{}
+			require.NoError(t, json.Unmarshal(tc.item(t), &nad))
+
+			networks, err := nad.vlanNetworks()
+			if tc.Invalid {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			expected := []vlanNetwork{}
+			for _, network := range tc.Networks {
+				expected = append(expected, vlanNetwork{clusterNetwork: network.ClusterNetwork, vlan: network.VLAN})
+			}
+			assert.Equal(t, expected, networks)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	maxNamespaceLength   = 63
+	maxNetworkNameLength = 253
+)
+
+// normalizeNetworkName returns a multus network name as "namespace/name".
+//
+// KubeVirt resolves a bare "name" against the namespace of the VirtualMachine, so the same network can be written
+// either way. The namespace must be a DNS label and the name a DNS subdomain, like their Kubernetes objects.
+func normalizeNetworkName(networkName, namespace string) (string, error) {
+	networkNamespace, name, found := strings.Cut(networkName, "/")
+	if !found {
+		networkNamespace, name = namespace, networkName
+	}
+
+	if !isDNSLabel(networkNamespace, maxNamespaceLength) {
+		return "", fmt.Errorf("network '%s' has an invalid namespace '%s'", networkName, networkNamespace)
+	}
+
+	if !isDNSSubdomain(name) {
+		return "", fmt.Errorf("network '%s' has an invalid name '%s'", networkName, name)
+	}
+
+	return networkNamespace + "/" + name, nil
+}
+
+// isDNSLabel checks for lowercase alphanumerics and '-', starting and ending with an alphanumeric.
+func isDNSLabel(value string, maxLength int) bool {
+	if value == "" || len(value) > maxLength {
+		return false
+	}
+
+	for i, c := range value {
+		isAlphanumeric := (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+		if !isAlphanumeric && (c != '-' || i == 0 || i == len(value)-1) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isDNSSubdomain checks for DNS labels separated by '.'.
+func isDNSSubdomain(value string) bool {
+	if len(value) > maxNetworkNameLength {
+		return false
+	}
+
+	for _, label := range strings.Split(value, ".") {
+		if !isDNSLabel(label, maxNetworkNameLength) {
+			return false
+		}
+	}
+
+	return true
+}
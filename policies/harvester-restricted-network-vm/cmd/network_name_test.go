@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeNetworkName(t *testing.T) {
+	longNamespace := strings.Repeat("n", 64)
+
+	tests := []struct {
+		name          string
+		networkName   string
+		normalized    string
+		expectedError string
+	}{
+		{name: "bare name", networkName: "network-1", normalized: "namespace-1/network-1"},
+		{name: "namespace and name", networkName: "namespace-2/network-1", normalized: "namespace-2/network-1"},
+		{name: "dotted name", networkName: "vlan.42", normalized: "namespace-1/vlan.42"},
+		{
+			name:          "empty name",
+			networkName:   "namespace-2/",
+			expectedError: "network 'namespace-2/' has an invalid name ''",
+		},
+		{
+			name:          "uppercase namespace",
+			networkName:   "Namespace-2/network-1",
+			expectedError: "network 'Namespace-2/network-1' has an invalid namespace 'Namespace-2'",
+		},
+		{
+			name:          "namespace too long",
+			networkName:   longNamespace + "/network-1",
+			expectedError: "network '" + longNamespace + "/network-1' has an invalid namespace '" + longNamespace + "'",
+		},
+		{
+			name:          "name ending with a dash",
+			networkName:   "network-",
+			expectedError: "network 'network-' has an invalid name 'network-'",
+		},
+		{
+			name:          "name with an empty label",
+			networkName:   "vlan..42",
+			expectedError: "network 'vlan..42' has an invalid name 'vlan..42'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, err := normalizeNetworkName(tt.networkName, "namespace-1")
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.normalized, normalized)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// regexPrefix marks a regular expression, e.g. "regex:team-(a|b)-.*".
+const regexPrefix = "regex:"
+
+const globCharacters = "*?["
+
+// nameMatcher matches a name exactly, with a glob, e.g. "team-a-*", or with a regular expression.
+// A regular expression must match the whole name.
+type nameMatcher struct {
+	value string
+	glob  bool
+	regex *regexp.Regexp
+}
+
+// isPattern checks whether a value is a glob or a regular expression, rather than a name.
+func isPattern(value string) bool {
+	return strings.HasPrefix(value, regexPrefix) || strings.ContainsAny(value, globCharacters)
+}
+
+func newNameMatcher(value string) (nameMatcher, error) {
+	if expression, ok := strings.CutPrefix(value, regexPrefix); ok {
+		regex, err := regexp.Compile("^(?:" + expression + ")$")
+		if err != nil {
+			return nameMatcher{}, fmt.Errorf("invalid regular expression '%s'", expression)
+		}
+		return nameMatcher{value: value, regex: regex}, nil
+	}
+
+	if strings.ContainsAny(value, globCharacters) {
+		if _, err := path.Match(value, ""); err != nil {
+			return nameMatcher{}, fmt.Errorf("invalid glob '%s'", value)
+		}
+		return nameMatcher{value: value, glob: true}, nil
+	}
+
+	return nameMatcher{value: value}, nil
+}
+
+func (m nameMatcher) matches(name string) bool {
+	switch {
+	case m.regex != nil:
+		return m.regex.MatchString(name)
+	case m.glob:
+		// the pattern is validated when it's compiled
+		matched, _ := path.Match(m.value, name)
+		return matched
+	default:
+		return m.value == name
+	}
+}
+
+// networkBindingMatcher is a compiled NamespaceNetworkBinding.
+type networkBindingMatcher struct {
+	namespace nameMatcher
+	// network matches "namespace/name"
+	network nameMatcher
+}
+
+// compile validates the names or the patterns of the binding, and compiles them.
+//
+// A network without a namespace is a network of the bound namespace, so the namespace can't be a pattern then.
+// A glob doesn't match '/', so "shared-net/*" matches every network of the shared-net namespace.
+func (b *NamespaceNetworkBinding) compile() (networkBindingMatcher, error) {
+	if !isPattern(b.Namespace) && !isDNSLabel(b.Namespace, maxNamespaceLength) {
+		return networkBindingMatcher{}, fmt.Errorf("invalid namespace '%s'", b.Namespace)
+	}
+
+	namespace, err := newNameMatcher(b.Namespace)
+	if err != nil {
+		return networkBindingMatcher{}, err
+	}
+
+	network := b.Network
+	isBare := !strings.HasPrefix(network, regexPrefix) && !strings.Contains(network, "/")
+	if isBare && isPattern(b.Namespace) {
+		return networkBindingMatcher{},
+			fmt.Errorf("network '%s' must be namespace/name when the namespace is a pattern", b.Network)
+	}
+
+	switch {
+	case !isPattern(network):
+		network, err = normalizeNetworkName(network, b.Namespace)
+		if err != nil {
+			return networkBindingMatcher{}, err
+		}
+	case isBare:
+		network = b.Namespace + "/" + network
+	}
+
+	networkMatcher, err := newNameMatcher(network)
+	if err != nil {
+		return networkBindingMatcher{}, err
+	}
+
+	return networkBindingMatcher{namespace: namespace, network: networkMatcher}, nil
+}
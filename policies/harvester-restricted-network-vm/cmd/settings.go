@@ -2,8 +2,9 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-restricted-network-vm/internal/logger"
 	"github.com/francoispqt/onelog"
@@ -11,73 +12,164 @@ import (
 	kubewardenProtocol "github.com/kubewarden/policy-sdk-go/protocol"
 )
 
+// SettingsError lists every problem found in the settings.
 type SettingsError struct {
-	Namespace string
-	Network   string
+	Problems []string
 }
 
 func (s *SettingsError) Error() string {
-	return fmt.Sprintf(
-		"Invalid settings error, namespace and network must be specified. Namespace: '%s', Network: '%s'",
-		s.Namespace,
-		s.Network,
-	)
+	return strings.Join(s.Problems, "; ")
 }
 
 type NamespaceNetworkBinding struct {
 	Namespace string `json:"namespace"`
-	Network   string `json:"network"`
+	// Network is "namespace/name", or "name" for a network of the bound namespace.
+	Network string `json:"network"`
 }
 
 // Settings is the structure that describes the policy settings.
 type Settings struct {
 	NamespaceNetworkBindings []NamespaceNetworkBinding `json:"namespaceNetworkBindings"`
+	// NamespaceInterfaceLimits cap the interfaces of a VM, and the interfaces on a network summed over the VMs
+	// of the namespace. The network limits list the VirtualMachines of the namespace.
+	NamespaceInterfaceLimits []NamespaceInterfaceLimit `json:"namespaceInterfaceLimits,omitempty"`
+	// NamespaceVLANBindings resolve the networks of a VM to their NetworkAttachmentDefinitions, and check
+	// their VLANs, whatever the networks are called.
+	NamespaceVLANBindings []NamespaceVLANBinding `json:"namespaceVLANBindings,omitempty"`
+	// ReservedVLANs can only be used by their system namespaces, they take precedence over the VLAN bindings.
+	ReservedVLANs []ReservedVLANs `json:"reservedVLANs,omitempty"`
+	// DenyPodNetworkFor are namespaces whose VMs cannot use the pod network.
+	DenyPodNetworkFor []string `json:"denyPodNetworkFor,omitempty"`
+	// AllowPodNetworkFor are namespaces with network bindings whose VMs can use the pod network too,
+	// the VMs of the other bound namespaces can only use multus networks.
+	AllowPodNetworkFor []string `json:"allowPodNetworkFor,omitempty"`
+	// NetworkInterfaceBindings limit the binding methods of the interfaces connected to a network.
+	NetworkInterfaceBindings []NetworkInterfaceBinding `json:"networkInterfaceBindings,omitempty"`
+	// RestrictedBindingMethods can only be used on the networks whose interface bindings list them, e.g. "sriov".
+	RestrictedBindingMethods []string `json:"restrictedBindingMethods,omitempty"`
+	// NamespaceMACPrefixes limit the MAC addresses of the listed namespaces, the others can use any MAC address.
+	NamespaceMACPrefixes []NamespaceMACPrefixes `json:"namespaceMACPrefixes,omitempty"`
+	// UniqueMACAddresses rejects a MAC address that another VM already uses on the same multus network.
+	// It lists the VirtualMachines of the cluster.
+	UniqueMACAddresses bool `json:"uniqueMACAddresses,omitempty"`
+
+	// networkBindings are compiled from NamespaceNetworkBindings by valid, or on the first lookup
+	networkBindings []networkBindingMatcher
 }
 
 func NewSettingsFromValidationReq(validationReq *kubewardenProtocol.ValidationRequest) (Settings, error) {
+	return parseSettings(validationReq.Settings)
+}
+
+// parseSettings decodes the settings with decodeStrict.
+func parseSettings(payload []byte) (Settings, error) {
 	settings := Settings{}
-	err := json.Unmarshal(validationReq.Settings, &settings)
+	err := decodeStrict(payload, &settings)
 	return settings, err
 }
 
 func (s *Settings) valid() (bool, error) {
-	for _, ns := range s.NamespaceNetworkBindings {
+	problems := s.networkBindingProblems()
+	problems = append(problems, s.vlanBindingProblems()...)
+	problems = append(problems, s.reservedProblems()...)
+	problems = append(problems, s.interfaceBindingProblems()...)
+	problems = append(problems, s.macPrefixProblems()...)
+	problems = append(problems, s.interfaceLimitProblems()...)
+
+	for i, namespace := range s.DenyPodNetworkFor {
+		if !isDNSLabel(namespace, maxNamespaceLength) {
+			problems = append(problems, fmt.Sprintf("denyPodNetworkFor[%d]: invalid namespace '%s'", i, namespace))
+		}
+	}
+
+	for i, namespace := range s.AllowPodNetworkFor {
+		switch {
+		case !isDNSLabel(namespace, maxNamespaceLength):
+			problems = append(problems, fmt.Sprintf("allowPodNetworkFor[%d]: invalid namespace '%s'", i, namespace))
+		case slices.Contains(s.DenyPodNetworkFor, namespace):
+			problems = append(problems,
+				fmt.Sprintf("allowPodNetworkFor[%d]: namespace '%s' is in denyPodNetworkFor", i, namespace))
+		}
+	}
+
+	if len(problems) > 0 {
+		return false, &SettingsError{Problems: problems}
+	}
+	return true, nil
+}
+
+// networkBindingProblems compiles the network bindings, and lists the invalid and duplicated ones.
+func (s *Settings) networkBindingProblems() []string {
+	problems := []string{}
+	seen := map[NamespaceNetworkBinding]int{}
+	s.networkBindings = []networkBindingMatcher{}
+
+	for i, ns := range s.NamespaceNetworkBindings {
 		// Check if namespace and network are not empty
 		if ns.Namespace == "" || ns.Network == "" {
-			return false, &SettingsError{
-				Namespace: ns.Namespace,
-				Network:   ns.Network,
-			}
+			problems = append(problems,
+				fmt.Sprintf("namespaceNetworkBindings[%d]: namespace and network must be specified", i))
+			continue
+		}
+
+		binding, err := ns.compile()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("namespaceNetworkBindings[%d]: %v", i, err))
+			continue
+		}
+
+		key := NamespaceNetworkBinding{Namespace: binding.namespace.value, Network: binding.network.value}
+		if first, ok := seen[key]; ok {
+			problems = append(problems,
+				fmt.Sprintf("namespaceNetworkBindings[%d]: duplicate of namespaceNetworkBindings[%d]", i, first))
+			continue
 		}
+		seen[key] = i
+		s.networkBindings = append(s.networkBindings, binding)
 	}
-	return true, nil
+
+	return problems
+}
+
+// compiledNetworkBindings returns the compiled network bindings, invalid bindings are rejected with the settings.
+func (s *Settings) compiledNetworkBindings() []networkBindingMatcher {
+	if s.networkBindings == nil {
+		s.networkBindingProblems()
+	}
+
+	return s.networkBindings
 }
 
 func validateSettings(ctx context.Context, payload []byte) ([]byte, error) {
 	l := logger.FromContext(ctx)
 	l.Info("validating settings")
 
-	settings := Settings{}
-	err := json.Unmarshal(payload, &settings)
+	settings, err := parseSettings(payload)
 	if err != nil {
 		return kubewarden.RejectSettings(kubewarden.Message(fmt.Sprintf("Invalid settings JSON: %v", err)))
 	}
 
 	valid, err := settings.valid()
 	if !valid || err != nil {
-		return kubewarden.RejectSettings("settings are not valid")
+		l.Info(fmt.Sprintf("settings are not valid: %v", err))
+		return kubewarden.RejectSettings(kubewarden.Message(fmt.Sprintf("settings are not valid: %v", err)))
 	}
 
 	return kubewarden.AcceptSettings()
 }
 
 // isNetworkAllowed verifies if a (namespace, network) combination is allowed.
+// The network is "namespace/name", and it's compared with the normalized networks of the bindings.
 //
 // Restrictions
 //   - namespaces with network bindings can only accept a network bound to it
 //   - networks with namespace bindings can only accept a namespace bound to it
 //   - If a namespace and network don't have a binding, then it's unrestricted
 //
+// The namespaces and networks of the bindings can be globs or regular expressions, a namespace or a network
+// matched by a pattern is bound like a name. Overlapping patterns add up: a combination is allowed as soon as
+// one binding matches both the namespace and the network.
+//
 // example:
 //
 //	  settings:
@@ -86,13 +178,13 @@ func validateSettings(ctx context.Context, payload []byte) ([]byte, error) {
 //
 // Allowed:
 //
-//	{"namespace": "restricted-namespace", "network": "restricted-network"}
-//	{"namespace": "random-namespace", "network": "random-network"}
+//	{"namespace": "restricted-namespace", "network": "restricted-namespace/restricted-network"}
+//	{"namespace": "random-namespace", "network": "random-namespace/random-network"}
 //
 // Denied:
 //
-//	{"namespace": "restricted-namespace", "network": "random-network"}
-//	{"namespace": "random-namespace", "network": "restricted-network"}
+//	{"namespace": "restricted-namespace", "network": "random-namespace/random-network"}
+//	{"namespace": "random-namespace", "network": "restricted-namespace/restricted-network"}
 func (s *Settings) isNetworkAllowed(ctx context.Context, namespace, network string) bool {
 	l := logger.FromContext(ctx).With(func(entry onelog.Entry) {
 		entry.String("namespace", namespace)
@@ -100,19 +192,22 @@ func (s *Settings) isNetworkAllowed(ctx context.Context, namespace, network stri
 	})
 	allowed := true
 
-	for _, ns := range s.NamespaceNetworkBindings {
+	for _, binding := range s.compiledNetworkBindings() {
+		namespaceMatches := binding.namespace.matches(namespace)
+		networkMatches := binding.network.matches(network)
+
 		// if a namespace is bound, then its network must be bound to it
-		if ns.Namespace == namespace && ns.Network != network {
+		if namespaceMatches && !networkMatches {
 			allowed = false
 		}
 
 		// if a network is bound, then its namespace must be bound to it
-		if ns.Network == network && ns.Namespace != namespace {
+		if networkMatches && !namespaceMatches {
 			allowed = false
 		}
 
 		// network and namespace are bound
-		if ns.Network == network && ns.Namespace == namespace {
+		if networkMatches && namespaceMatches {
 			l.Debug("network and namespace matched")
 			return true
 		}
@@ -127,3 +222,19 @@ func (s *Settings) isNetworkAllowed(ctx context.Context, namespace, network stri
 	l.Debug("namespace or network is restricted and cannot bound together")
 	return false
 }
+
+// isPodNetworkAllowed verifies if the VMs of a namespace can use the pod network.
+// A namespace with network bindings is restricted to them, unless it's in AllowPodNetworkFor.
+func (s *Settings) isPodNetworkAllowed(namespace string) bool {
+	if slices.Contains(s.DenyPodNetworkFor, namespace) {
+		return false
+	}
+
+	if slices.Contains(s.AllowPodNetworkFor, namespace) {
+		return true
+	}
+
+	return !slices.ContainsFunc(s.compiledNetworkBindings(), func(binding networkBindingMatcher) bool {
+		return binding.namespace.matches(namespace)
+	})
+}
@@ -41,8 +41,7 @@ func TestValid(t *testing.T) {
 			result:      false,
 			expectError: true,
 			expectedError: &SettingsError{
-				Namespace: "",
-				Network:   "network1",
+				Problems: []string{"namespaceNetworkBindings[0]: namespace and network must be specified"},
 			},
 		},
 		{
@@ -55,8 +54,7 @@ func TestValid(t *testing.T) {
 			result:      false,
 			expectError: true,
 			expectedError: &SettingsError{
-				Namespace: "namespace1",
-				Network:   "",
+				Problems: []string{"namespaceNetworkBindings[0]: namespace and network must be specified"},
 			},
 		},
 		{
@@ -69,8 +67,131 @@ func TestValid(t *testing.T) {
 			result:      false,
 			expectError: true,
 			expectedError: &SettingsError{
-				Namespace: "",
-				Network:   "",
+				Problems: []string{"namespaceNetworkBindings[0]: namespace and network must be specified"},
+			},
+		},
+		{
+			name: "Valid settings with a network written with and without its namespace",
+			settings: Settings{
+				NamespaceNetworkBindings: []NamespaceNetworkBinding{
+					{Namespace: "namespace1", Network: "network1"},
+					{Namespace: "namespace2", Network: "namespace1/network1"},
+				},
+			},
+			result: true,
+		},
+		{
+			name: "Invalid settings with malformed names",
+			settings: Settings{
+				NamespaceNetworkBindings: []NamespaceNetworkBinding{
+					{Namespace: "Namespace1", Network: "network1"},
+					{Namespace: "namespace1", Network: "namespace1/network/1"},
+					{Namespace: "namespace1", Network: "/network1"},
+					{Namespace: "namespace1", Network: "namespace1/-network1"},
+				},
+			},
+			result:      false,
+			expectError: true,
+			expectedError: &SettingsError{
+				Problems: []string{
+					"namespaceNetworkBindings[0]: invalid namespace 'Namespace1'",
+					"namespaceNetworkBindings[1]: network 'namespace1/network/1' has an invalid name 'network/1'",
+					"namespaceNetworkBindings[2]: network '/network1' has an invalid namespace ''",
+					"namespaceNetworkBindings[3]: network 'namespace1/-network1' has an invalid name '-network1'",
+				},
+			},
+		},
+		{
+			name: "Invalid settings with a duplicate written without its namespace",
+			settings: Settings{
+				NamespaceNetworkBindings: []NamespaceNetworkBinding{
+					{Namespace: "namespace1", Network: "namespace1/network1"},
+					{Namespace: "namespace1", Network: "network1"},
+				},
+			},
+			result:      false,
+			expectError: true,
+			expectedError: &SettingsError{
+				Problems: []string{"namespaceNetworkBindings[1]: duplicate of namespaceNetworkBindings[0]"},
+			},
+		},
+		{
+			name: "Invalid settings with a malformed pod network namespace",
+			settings: Settings{
+				DenyPodNetworkFor: []string{"namespace1", ""},
+			},
+			result:      false,
+			expectError: true,
+			expectedError: &SettingsError{
+				Problems: []string{"denyPodNetworkFor[1]: invalid namespace ''"},
+			},
+		},
+		{
+			name: "Invalid settings with a pod network namespace allowed and denied",
+			settings: Settings{
+				DenyPodNetworkFor:  []string{"namespace1"},
+				AllowPodNetworkFor: []string{"namespace2", "namespace1", "Namespace3"},
+			},
+			result:      false,
+			expectError: true,
+			expectedError: &SettingsError{
+				Problems: []string{
+					"allowPodNetworkFor[1]: namespace 'namespace1' is in denyPodNetworkFor",
+					"allowPodNetworkFor[2]: invalid namespace 'Namespace3'",
+				},
+			},
+		},
+		{
+			name: "Valid settings with patterns",
+			settings: Settings{
+				NamespaceNetworkBindings: []NamespaceNetworkBinding{
+					{Namespace: "team-a-*", Network: "shared-net/*"},
+					{Namespace: "regex:team-(a|b)-dev", Network: "regex:dev-.*/net-[0-9]+"},
+					{Namespace: "team-c", Network: "net-?"},
+				},
+			},
+			result: true,
+		},
+		{
+			name: "Invalid settings with malformed patterns",
+			settings: Settings{
+				NamespaceNetworkBindings: []NamespaceNetworkBinding{
+					{Namespace: "team-[a", Network: "shared-net/network-1"},
+					{Namespace: "regex:team-(a", Network: "shared-net/network-1"},
+					{Namespace: "team-a", Network: "shared-net/net-[1"},
+					{Namespace: "team-a-*", Network: "network-1"},
+					{Namespace: "team-a-*", Network: "shared-net/*"},
+					{Namespace: "team-a-*", Network: "shared-net/*"},
+				},
+			},
+			result:      false,
+			expectError: true,
+			expectedError: &SettingsError{
+				Problems: []string{
+					"namespaceNetworkBindings[0]: invalid glob 'team-[a'",
+					"namespaceNetworkBindings[1]: invalid regular expression 'team-(a'",
+					"namespaceNetworkBindings[2]: invalid glob 'shared-net/net-[1'",
+					"namespaceNetworkBindings[3]: network 'network-1' must be namespace/name when the namespace is a pattern",
+					"namespaceNetworkBindings[5]: duplicate of namespaceNetworkBindings[4]",
+				},
+			},
+		},
+		{
+			name: "Invalid settings with every problem listed",
+			settings: Settings{
+				NamespaceNetworkBindings: []NamespaceNetworkBinding{
+					{Namespace: "namespace1", Network: "network1"},
+					{Namespace: "", Network: "network1"},
+					{Namespace: "namespace1", Network: "network1"},
+				},
+			},
+			result:      false,
+			expectError: true,
+			expectedError: &SettingsError{
+				Problems: []string{
+					"namespaceNetworkBindings[1]: namespace and network must be specified",
+					"namespaceNetworkBindings[2]: duplicate of namespaceNetworkBindings[0]",
+				},
 			},
 		},
 	}
@@ -126,10 +247,11 @@ func TestValidateSettings(t *testing.T) {
 					}
 				]
 			}`),
-			result: `{"valid":false,"message":"settings are not valid"}`,
+			result: `{"valid":false,"message":"settings are not valid: ` +
+				`namespaceNetworkBindings[0]: namespace and network must be specified"}`,
 		},
 		{
-			name: "Missing namespace",
+			name: "Missing network",
 			payload: []byte(`{
 				"namespaceNetworkBindings": [
 					{
@@ -137,7 +259,25 @@ func TestValidateSettings(t *testing.T) {
 					}
 				]
 			}`),
-			result: `{"valid":false,"message":"settings are not valid"}`,
+			result: `{"valid":false,"message":"settings are not valid: ` +
+				`namespaceNetworkBindings[0]: namespace and network must be specified"}`,
+		},
+		{
+			name: "Unknown field",
+			payload: []byte(`{
+				"namespaceNetworkBinding": [
+					{
+						"namespace": "test-restricted-namespace-1",
+						"network": "test-restricted-network-1"
+					}
+				]
+			}`),
+			result: `{"valid":false,"message":"Invalid settings JSON: json: unknown field \"namespaceNetworkBinding\""}`,
+		},
+		{
+			name:    "Trailing delimiter",
+			payload: []byte(`{"namespaceNetworkBindings": []}}`),
+			result:  `{"valid":false,"message":"Invalid settings JSON: unexpected data after the JSON object"}`,
 		},
 	}
 	for _, tt := range tests {
@@ -156,15 +296,19 @@ func TestIsNetworkAllowed(t *testing.T) {
 		"namespaceNetworkBindings": [
 		{
 			"namespace": "test-restricted-namespace-1",
-			"network": "test-restricted-network-1"
+			"network": "test-restricted-namespace-1/test-restricted-network-1"
 		},
 		{
 			"namespace": "test-restricted-namespace-2",
-			"network": "test-restricted-network-2"
+			"network": "test-restricted-namespace-2/test-restricted-network-2"
 		},
 		{
 			"namespace": "test-restricted-namespace-3",
-			"network": "test-restricted-network-2"
+			"network": "test-restricted-namespace-2/test-restricted-network-2"
+		},
+		{
+			"namespace": "test-restricted-namespace-4",
+			"network": "test-restricted-network-4"
 		}
 		]
 	}`)
@@ -181,37 +325,49 @@ func TestIsNetworkAllowed(t *testing.T) {
 		{
 			name:      "Valid pair namespace and network",
 			namespace: "test-restricted-namespace-1",
-			network:   "test-restricted-network-1",
+			network:   "test-restricted-namespace-1/test-restricted-network-1",
 			result:    true,
 		},
 		{
 			name:      "Valid pair: when the network is also allowed in a different namespace",
 			namespace: "test-restricted-namespace-2",
-			network:   "test-restricted-network-2",
+			network:   "test-restricted-namespace-2/test-restricted-network-2",
 			result:    true,
 		},
 		{
 			name:      "Valid pair: when the network is from a different namespace",
 			namespace: "test-restricted-namespace-3",
-			network:   "test-restricted-network-2",
+			network:   "test-restricted-namespace-2/test-restricted-network-2",
 			result:    true,
 		},
 		{
 			name:      "Valid pair: non-restricted-namespace with a non-restricted network",
 			namespace: "random-non-restricted-namespace",
-			network:   "random-non-restricted-network",
+			network:   "random-non-restricted-namespace/random-non-restricted-network",
 			result:    true,
 		},
 		{
 			name:      "Invalid pair: restricted-namespace with a non-restricted network",
 			namespace: "test-restricted-namespace-1",
-			network:   "random-non-restricted-network",
+			network:   "random-non-restricted-namespace/random-non-restricted-network",
 			result:    false,
 		},
 		{
 			name:      "Invalid pair: non-restricted-namespace with a restricted network",
 			namespace: "random-non-restricted-namespace",
-			network:   "test-restricted-network-2",
+			network:   "test-restricted-namespace-2/test-restricted-network-2",
+			result:    false,
+		},
+		{
+			name:      "Valid pair: network bound without its namespace",
+			namespace: "test-restricted-namespace-4",
+			network:   "test-restricted-namespace-4/test-restricted-network-4",
+			result:    true,
+		},
+		{
+			name:      "Invalid pair: network of the same name in another namespace",
+			namespace: "test-restricted-namespace-4",
+			network:   "random-non-restricted-namespace/test-restricted-network-4",
 			result:    false,
 		},
 	}
@@ -223,6 +379,103 @@ func TestIsNetworkAllowed(t *testing.T) {
 	}
 }
 
+func TestIsNetworkAllowedWithPatterns(t *testing.T) {
+	ctx := context.Background()
+	settings := Settings{
+		NamespaceNetworkBindings: []NamespaceNetworkBinding{
+			{Namespace: "team-a-*", Network: "shared-net/*"},
+			{Namespace: "team-a-dev", Network: "dev-net/network-1"},
+			{Namespace: "regex:team-(a|b)-dev", Network: "regex:lab-.*/net-[0-9]+"},
+			{Namespace: "team-c", Network: "net-?"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		network   string
+		result    bool
+	}{
+		{
+			name:      "glob namespace with a glob network",
+			namespace: "team-a-prod",
+			network:   "shared-net/network-1",
+			result:    true,
+		},
+		{
+			name:      "overlapping globs: the exact binding",
+			namespace: "team-a-dev",
+			network:   "dev-net/network-1",
+			result:    true,
+		},
+		{
+			name:      "overlapping globs: the pattern binding",
+			namespace: "team-a-dev",
+			network:   "shared-net/network-2",
+			result:    true,
+		},
+		{
+			name:      "overlapping regular expression",
+			namespace: "team-a-dev",
+			network:   "lab-1/net-42",
+			result:    true,
+		},
+		{
+			name:      "regular expression namespace",
+			namespace: "team-b-dev",
+			network:   "lab-2/net-1",
+			result:    true,
+		},
+		{
+			name:      "network bound to another namespace of the glob",
+			namespace: "team-a-prod",
+			network:   "dev-net/network-1",
+			result:    false,
+		},
+		{
+			name:      "glob network of an unbound namespace",
+			namespace: "team-b-prod",
+			network:   "shared-net/network-1",
+			result:    false,
+		},
+		{
+			name:      "glob doesn't match across namespaces",
+			namespace: "team-a-prod",
+			network:   "shared-net-2/network-1",
+			result:    false,
+		},
+		{
+			name:      "regular expression matches the whole name",
+			namespace: "team-b-dev",
+			network:   "lab-2/net-1a",
+			result:    false,
+		},
+		{
+			name:      "bare glob network of the bound namespace",
+			namespace: "team-c",
+			network:   "team-c/net-1",
+			result:    true,
+		},
+		{
+			name:      "bare glob network of another namespace",
+			namespace: "team-c",
+			network:   "team-d/net-1",
+			result:    false,
+		},
+		{
+			name:      "unrestricted",
+			namespace: "random-namespace",
+			network:   "random-namespace/random-network",
+			result:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.result, settings.isNetworkAllowed(ctx, tt.namespace, tt.network))
+		})
+	}
+}
+
 func TestNewSettingsFromValidationReq(t *testing.T) {
 	settingsJSON := []byte(`{
 		"namespaceNetworkBindings": [
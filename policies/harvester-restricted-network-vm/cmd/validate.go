@@ -4,11 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-restricted-network-vm/internal/logger"
 
 	"github.com/francoispqt/onelog"
 	kubewarden "github.com/kubewarden/policy-sdk-go"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
 	kubewardenProtocol "github.com/kubewarden/policy-sdk-go/protocol"
 )
 
@@ -30,19 +32,17 @@ func validate(ctx context.Context, payload []byte) ([]byte, error) {
 			kubewarden.Code(httpBadRequestStatusCode))
 	}
 
-	virtualMachineJSON := validationRequest.Request.Object
-
-	virtualMachineObject := virtualMachine{}
-	err = json.Unmarshal(virtualMachineJSON, &virtualMachineObject)
+	object, err := decodeVMObject(validationRequest.Request.Kind, validationRequest.Request.Object)
 	if err != nil {
 		return kubewarden.RejectRequest(
 			kubewarden.Message(err.Error()),
 			kubewarden.Code(httpBadRequestStatusCode))
 	}
-	namespace := virtualMachineObject.Metadata.Namespace
-	vmNetworkList := virtualMachineObject.Spec.Template.Spec.Networks
+	namespace := object.vm.Metadata.Namespace
+	vmNetworkList := object.vm.Spec.Template.Spec.Networks
 
 	l := logger.FromContext(ctx).With(func(entry onelog.Entry) {
+		entry.String("kind", validationRequest.Request.Kind.Kind)
 		entry.String("namespace", namespace)
 		entry.String("networks", fmt.Sprintf("%+v", vmNetworkList))
 	})
@@ -50,17 +50,108 @@ func validate(ctx context.Context, payload []byte) ([]byte, error) {
 	l.Info("VM_CHECK namespace/network")
 	for _, network := range vmNetworkList {
 		networkName := network.Multus.NetworkName
-		if !settings.isNetworkAllowed(ctx, namespace, networkName) {
+		rejection, err := networkRejection(ctx, &settings, namespace, &network)
+		if err != nil {
+			return kubewarden.RejectRequest(
+				kubewarden.Message(err.Error()),
+				kubewarden.Code(httpBadRequestStatusCode))
+		}
+
+		if rejection != "" {
 			l.InfoWithFields("VM_REJECTED namespace/network", func(entry onelog.Entry) {
 				entry.String("network", networkName)
 			})
-			return kubewarden.RejectRequest(
-				kubewarden.Message(
-					fmt.Sprintf("Network '%s' is not allowed for namespace: '%s'", networkName, namespace)),
-				kubewarden.Code(httpBadRequestStatusCode))
+			return kubewarden.RejectRequest(kubewarden.Message(rejection), kubewarden.Code(httpBadRequestStatusCode))
 		}
 	}
 
+	rejection, err := interfaceRejection(&settings, namespace, &object.vm.Spec.Template.Spec)
+	host := capabilities.NewHost()
+	if err == nil && rejection == "" && settings.UniqueMACAddresses {
+		rejection, err = macAddressConflictRejection(&host, &object)
+	}
+	if err == nil && rejection == "" {
+		rejection, err = interfaceLimitRejection(&host, &settings, &object)
+	}
+	if err != nil {
+		return kubewarden.RejectRequest(
+			kubewarden.Message(err.Error()),
+			kubewarden.Code(httpBadRequestStatusCode))
+	}
+
+	if rejection != "" {
+		l.InfoWithFields("VM_REJECTED namespace/interface", func(entry onelog.Entry) {
+			entry.String("rejection", rejection)
+		})
+		return kubewarden.RejectRequest(kubewarden.Message(rejection), kubewarden.Code(httpBadRequestStatusCode))
+	}
+
 	l.Info("VM_ALLOWED namespace")
 	return kubewarden.AcceptRequest()
 }
+
+// networkRejection checks the pod network of the VM against the pod network settings, and a multus network
+// against the network bindings and, when the networks are resolved, against the VLAN bindings.
+// It returns why the network is rejected, or an empty string when it's allowed.
+func networkRejection(ctx context.Context, settings *Settings, namespace string, network *vmNetwork) (string, error) {
+	if network.Pod != nil {
+		if !settings.isPodNetworkAllowed(namespace) {
+			return fmt.Sprintf("Pod network is not allowed for namespace: '%s'", namespace), nil
+		}
+		return "", nil
+	}
+
+	networkName := network.Multus.NetworkName
+	normalizedName := networkName
+	if networkName != "" {
+		var err error
+		normalizedName, err = normalizeNetworkName(networkName, namespace)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !settings.isNetworkAllowed(ctx, namespace, normalizedName) {
+		return fmt.Sprintf("Network '%s' is not allowed for namespace: '%s'", networkName, namespace), nil
+	}
+
+	if !settings.resolvesNetworks() || networkName == "" {
+		return "", nil
+	}
+
+	host := capabilities.NewHost()
+	return vlanRejection(ctx, &host, settings, namespace, normalizedName)
+}
+
+// vlanRejection resolves a "namespace/name" network to its NetworkAttachmentDefinition, and checks its VLANs
+// against the VLAN bindings. It returns why the network is rejected, or an empty string when it's allowed.
+func vlanRejection(
+	ctx context.Context,
+	host *capabilities.Host,
+	settings *Settings,
+	namespace, networkName string,
+) (string, error) {
+	nad, err := getNetworkAttachmentDefinition(host, networkName)
+	if err != nil {
+		return "", err
+	}
+
+	networks, err := nad.vlanNetworks()
+	if err != nil {
+		return "", fmt.Errorf("NetworkAttachmentDefinition '%s': %w", networkName, err)
+	}
+
+	for _, network := range networks {
+		if !settings.isVLANAllowed(ctx, namespace, network.clusterNetwork, network.vlan) {
+			vlan := strconv.Itoa(network.vlan)
+			if network.vlan == untaggedVLAN {
+				vlan = "untagged"
+			}
+
+			return fmt.Sprintf("VLAN %s on cluster network '%s' of network '%s' is not allowed for namespace: '%s'",
+				vlan, network.clusterNetwork, networkName, namespace), nil
+		}
+	}
+
+	return "", nil
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"testing"
 
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
 	kubewardenProtocol "github.com/kubewarden/policy-sdk-go/protocol"
 	kubewardenTesting "github.com/kubewarden/policy-sdk-go/testing"
 	"github.com/stretchr/testify/assert"
@@ -33,6 +36,80 @@ func getVMObject(vmName, namespace, network string) virtualMachine {
 	}
 }
 
+func getPodNetworkVMObject(vmName, namespace string) virtualMachine {
+	vmObject := getVMObject(vmName, namespace, "")
+	vmObject.Spec.Template.Spec.Networks[0] = vmNetwork{Name: "default", Pod: &podNetwork{}}
+	return vmObject
+}
+
+func TestPodNetwork(t *testing.T) {
+	ctx := context.Background()
+	bindings := []NamespaceNetworkBinding{
+		{Network: "restricted-network", Namespace: "restricted-namespace"},
+	}
+
+	tests := []struct {
+		name         string
+		settings     Settings
+		namespace    string
+		result       bool
+		errorMessage string
+	}{
+		{
+			name:         "Reject: pod network of a bound namespace",
+			settings:     Settings{NamespaceNetworkBindings: bindings},
+			namespace:    "restricted-namespace",
+			errorMessage: "Pod network is not allowed for namespace: 'restricted-namespace'",
+		},
+		{
+			name:      "Approve: pod network of an unbound namespace",
+			settings:  Settings{NamespaceNetworkBindings: bindings},
+			namespace: "random-namespace",
+			result:    true,
+		},
+		{
+			name:      "Approve: pod network of a bound namespace that allows it",
+			settings:  Settings{NamespaceNetworkBindings: bindings, AllowPodNetworkFor: []string{"restricted-namespace"}},
+			namespace: "restricted-namespace",
+			result:    true,
+		},
+		{
+			name:         "Reject: pod network of a denied namespace",
+			settings:     Settings{DenyPodNetworkFor: []string{"random-namespace"}},
+			namespace:    "random-namespace",
+			errorMessage: "Pod network is not allowed for namespace: 'random-namespace'",
+		},
+		{
+			name: "Reject: pod network of a bound namespace matched by a pattern",
+			settings: Settings{NamespaceNetworkBindings: []NamespaceNetworkBinding{
+				{Namespace: "team-*", Network: "shared/network-1"},
+			}},
+			namespace:    "team-a",
+			errorMessage: "Pod network is not allowed for namespace: 'team-a'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vmObject := getPodNetworkVMObject("test-VM", tt.namespace)
+			payload, err := kubewardenTesting.BuildValidationRequest(&vmObject, &tt.settings)
+			require.NoError(t, err)
+
+			responsePayload, err := validate(ctx, payload)
+			require.NoError(t, err)
+
+			var response kubewardenProtocol.ValidationResponse
+			err = json.Unmarshal(responsePayload, &response)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.result, response.Accepted)
+			if !tt.result {
+				assert.Equal(t, tt.errorMessage, *response.Message)
+			}
+		})
+	}
+}
+
 func TestApproval(t *testing.T) {
 	ctx := context.Background()
 
@@ -74,6 +151,63 @@ func TestApproval(t *testing.T) {
 			},
 			result: true,
 		},
+		{
+			name: "Approve: network bound with its namespace, used without it",
+			getPayload: func() []byte {
+				settings := Settings{
+					NamespaceNetworkBindings: []NamespaceNetworkBinding{
+						{
+							Network:   "restricted-namespace/restricted-network",
+							Namespace: "restricted-namespace",
+						},
+					},
+				}
+
+				vmObject := getVMObject("test-VM", "restricted-namespace", "restricted-network")
+
+				payload, err := kubewardenTesting.BuildValidationRequest(&vmObject, &settings)
+				assert.NoError(t, err)
+				return payload
+			},
+			result: true,
+		},
+		{
+			name: "Reject: network bound without its namespace, used with it from another namespace",
+			getPayload: func() []byte {
+				settings := Settings{
+					NamespaceNetworkBindings: []NamespaceNetworkBinding{
+						{
+							Network:   "restricted-network",
+							Namespace: "restricted-namespace",
+						},
+					},
+				}
+
+				vmObject := getVMObject("test-VM", "random-namespace", "restricted-namespace/restricted-network")
+
+				payload, err := kubewardenTesting.BuildValidationRequest(&vmObject, &settings)
+				assert.NoError(t, err)
+				return payload
+			},
+			result: false,
+			errorMessage: "Network 'restricted-namespace/restricted-network' is not allowed for namespace: " +
+				"'random-namespace'",
+			errorCode: httpBadRequestStatusCode,
+		},
+		{
+			name: "Reject: malformed network name",
+			getPayload: func() []byte {
+				settings := Settings{}
+				vmObject := getVMObject("test-VM", "random-namespace", "random-namespace/random/network")
+
+				payload, err := kubewardenTesting.BuildValidationRequest(&vmObject, &settings)
+				assert.NoError(t, err)
+				return payload
+			},
+			result:       false,
+			errorMessage: "network 'random-namespace/random/network' has an invalid name 'random/network'",
+			errorCode:    httpBadRequestStatusCode,
+		},
 		{
 			name: "Reject: Bad payload",
 			getPayload: func() []byte {
@@ -204,3 +338,87 @@ func TestApproval(t *testing.T) {
 		})
 	}
 }
+
+func TestVLANRejection(t *testing.T) {
+	ctx := context.Background()
+	settings := Settings{
+		NamespaceVLANBindings: []NamespaceVLANBinding{
+			{Namespace: "restricted-namespace", VLAN: 42},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		namespace     string
+		response      string
+		responseError error
+		rejection     string
+		expectedError string
+	}{
+		{
+			name:      "bound VLAN",
+			namespace: "restricted-namespace",
+			response:  `{"spec":{"config":"{\"type\":\"bridge\",\"bridge\":\"mgmt-br\",\"vlan\":42}"}}`,
+		},
+		{
+			name:      "VLAN of another namespace, whatever the network is called",
+			namespace: "random-namespace",
+			response:  `{"spec":{"config":"{\"type\":\"bridge\",\"bridge\":\"mgmt-br\",\"vlan\":42}"}}`,
+			rejection: "VLAN 42 on cluster network 'mgmt' of network 'shared-namespace/network-1' " +
+				"is not allowed for namespace: 'random-namespace'",
+		},
+		{
+			name:      "unbound VLAN of a bound namespace",
+			namespace: "restricted-namespace",
+			response:  `{"spec":{"config":{"type":"bridge","bridge":"mgmt-br"}}}`,
+			rejection: "VLAN untagged on cluster network 'mgmt' of network 'shared-namespace/network-1' " +
+				"is not allowed for namespace: 'restricted-namespace'",
+		},
+		{
+			name:      "macvlan VLAN of another namespace",
+			namespace: "random-namespace",
+			response: `{"metadata":{"labels":{"network.harvesterhci.io/clusternetwork":"mgmt"}},` +
+				`"spec":{"config":"{\"type\":\"macvlan\",\"master\":\"eth0.42\"}"}}`,
+			rejection: "VLAN 42 on cluster network 'mgmt' of network 'shared-namespace/network-1' " +
+				"is not allowed for namespace: 'random-namespace'",
+		},
+		{
+			name:          "NetworkAttachmentDefinition not found",
+			namespace:     "restricted-namespace",
+			responseError: errors.New("not found"),
+			expectedError: "cannot get NetworkAttachmentDefinition 'shared-namespace/network-1': not found",
+		},
+		{
+			name:      "invalid VLAN",
+			namespace: "restricted-namespace",
+			response:  `{"spec":{"config":{"type":"bridge","bridge":"mgmt-br","vlan":5000}}}`,
+			expectedError: "NetworkAttachmentDefinition 'shared-namespace/network-1': invalid 'bridge' plugin: " +
+				"vlan 5000 is out of range 1-4094",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockWapcClient := &mocks.MockWapcClient{}
+			mockWapcClient.
+				EXPECT().
+				HostCall("kubewarden", "kubernetes", "get_resource",
+					[]byte(`{"api_version":"k8s.cni.cncf.io/v1","kind":"NetworkAttachmentDefinition",`+
+						`"name":"network-1","namespace":"shared-namespace","disable_cache":false}`)).
+				Return([]byte(tt.response), tt.responseError).
+				Times(1)
+
+			host := &capabilities.Host{
+				Client: mockWapcClient,
+			}
+
+			rejection, err := vlanRejection(ctx, host, &settings, tt.namespace, "shared-namespace/network-1")
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.rejection, rejection)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	kubewardenProtocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+const (
+	virtualMachineInstanceKind        = "VirtualMachineInstance"
+	virtualMachinePoolAPIVersion      = "pool.kubevirt.io/v1alpha1"
+	virtualMachinePoolKind            = "VirtualMachinePool"
+	virtualMachineTemplateVersionKind = "VirtualMachineTemplateVersion"
+)
+
+// virtualMachineInstance is a VirtualMachineInstance, its spec holds the networks of a VM template.
+type virtualMachineInstance struct {
+	Metadata vmMetadata `json:"metadata"`
+	Spec     vmNetworks `json:"spec"`
+}
+
+// vmSource is a VirtualMachine nested in another object, the template of a pool or of a Harvester template version.
+type vmSource struct {
+	Spec vmPayloadSpec `json:"spec"`
+}
+
+type vmPoolSpec struct {
+	// Replicas defaults to 1, like KubeVirt does.
+	Replicas               *int     `json:"replicas,omitempty"`
+	VirtualMachineTemplate vmSource `json:"virtualMachineTemplate"`
+}
+
+func (s *vmPoolSpec) replicas() int {
+	if s.Replicas == nil {
+		return 1
+	}
+
+	return *s.Replicas
+}
+
+// virtualMachinePool is a pool.kubevirt.io VirtualMachinePool.
+type virtualMachinePool struct {
+	Metadata vmMetadata `json:"metadata"`
+	Spec     vmPoolSpec `json:"spec"`
+}
+
+type vmTemplateVersionSpec struct {
+	VM vmSource `json:"vm"`
+}
+
+// virtualMachineTemplateVersion is a harvesterhci.io VirtualMachineTemplateVersion.
+type virtualMachineTemplateVersion struct {
+	Metadata vmMetadata            `json:"metadata"`
+	Spec     vmTemplateVersionSpec `json:"spec"`
+}
+
+// vmObject is an object that creates VMs, with the networks and interfaces of its VMs in the shape of a
+// VirtualMachine, and the metadata of the object.
+type vmObject struct {
+	kind string
+	// replicas is the number of VMs that the object runs, a template version runs none by itself.
+	replicas int
+	// ownedByVM is set for a VirtualMachineInstance that a VirtualMachine runs, which the VirtualMachine counts for.
+	ownedByVM bool
+	vm        virtualMachine
+}
+
+// ownerReference is an owner of an object, e.g. the VirtualMachinePool that created a VirtualMachine.
+type ownerReference struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+type ownedMetadata struct {
+	OwnerReferences []ownerReference `json:"ownerReferences"`
+}
+
+// ownedObject decodes the owners of a listed object.
+type ownedObject struct {
+	Metadata ownedMetadata `json:"metadata"`
+}
+
+func (o *ownedObject) isOwnedBy(kind string) bool {
+	return slices.ContainsFunc(o.Metadata.OwnerReferences, func(owner ownerReference) bool {
+		return owner.Kind == kind
+	})
+}
+
+// decodeVMObject decodes the object of the request by its kind, a request without a kind is a VirtualMachine.
+func decodeVMObject(kind kubewardenProtocol.GroupVersionKind, object json.RawMessage) (vmObject, error) {
+	switch kind.Kind {
+	case "", virtualMachineKind:
+		vm := virtualMachine{}
+		err := json.Unmarshal(object, &vm)
+		return vmObject{kind: virtualMachineKind, replicas: 1, vm: vm}, err
+	case virtualMachineInstanceKind:
+		vmi := virtualMachineInstance{}
+		owned := ownedObject{}
+		err := json.Unmarshal(object, &vmi)
+		if err == nil {
+			err = json.Unmarshal(object, &owned)
+		}
+		vm := newVirtualMachine(vmi.Metadata, vmi.Spec)
+		return vmObject{kind: kind.Kind, replicas: 1, ownedByVM: owned.isOwnedBy(virtualMachineKind), vm: vm}, err
+	case virtualMachinePoolKind:
+		pool := virtualMachinePool{}
+		err := json.Unmarshal(object, &pool)
+		vm := virtualMachine{Metadata: pool.Metadata, Spec: pool.Spec.VirtualMachineTemplate.Spec}
+		return vmObject{kind: kind.Kind, replicas: pool.Spec.replicas(), vm: vm}, err
+	case virtualMachineTemplateVersionKind:
+		templateVersion := virtualMachineTemplateVersion{}
+		err := json.Unmarshal(object, &templateVersion)
+		vm := virtualMachine{Metadata: templateVersion.Metadata, Spec: templateVersion.Spec.VM.Spec}
+		return vmObject{kind: kind.Kind, vm: vm}, err
+	default:
+		return vmObject{}, fmt.Errorf("kind '%s' is not supported", kind.Kind)
+	}
+}
+
+func newVirtualMachine(metadata vmMetadata, spec vmNetworks) virtualMachine {
+	return virtualMachine{Metadata: metadata, Spec: vmPayloadSpec{Template: vmTemplate{Spec: spec}}}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	kubewardenProtocol "github.com/kubewarden/policy-sdk-go/protocol"
+	kubewardenTesting "github.com/kubewarden/policy-sdk-go/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKinds(t *testing.T) {
+	ctx := context.Background()
+	fixtures := []string{
+		"../test_data/virtualmachine.json",
+		"../test_data/virtualmachineinstance.json",
+		"../test_data/virtualmachinepool.json",
+		"../test_data/virtualmachinetemplateversion.json",
+	}
+
+	tests := []struct {
+		name         string
+		settings     Settings
+		result       bool
+		errorMessage string
+	}{
+		{
+			name: "Approve: network bound to the namespace",
+			settings: Settings{NamespaceNetworkBindings: []NamespaceNetworkBinding{
+				{Namespace: "default", Network: "vlan-42"},
+			}},
+			result: true,
+		},
+		{
+			name: "Reject: network bound to another namespace",
+			settings: Settings{NamespaceNetworkBindings: []NamespaceNetworkBinding{
+				{Namespace: "restricted-namespace", Network: "default/vlan-42"},
+			}},
+			errorMessage: "Network 'default/vlan-42' is not allowed for namespace: 'default'",
+		},
+		{
+			name: "Reject: interface binding method",
+			settings: Settings{NetworkInterfaceBindings: []NetworkInterfaceBinding{
+				{Network: "default/vlan-42", Methods: []string{"sriov"}},
+			}},
+			errorMessage: "Interface 'nic-1' cannot use the 'bridge' binding method",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		for _, tt := range tests {
+			t.Run(fixture+": "+tt.name, func(t *testing.T) {
+				payload, err := kubewardenTesting.BuildValidationRequestFromFixture(fixture, &tt.settings)
+				require.NoError(t, err)
+
+				responsePayload, err := validate(ctx, payload)
+				require.NoError(t, err)
+
+				var response kubewardenProtocol.ValidationResponse
+				err = json.Unmarshal(responsePayload, &response)
+				require.NoError(t, err)
+
+				assert.Equal(t, tt.result, response.Accepted)
+				if !tt.result {
+					assert.Equal(t, tt.errorMessage, *response.Message)
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeVMObjectUnsupportedKind(t *testing.T) {
+	kind := kubewardenProtocol.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	_, err := decodeVMObject(kind, json.RawMessage(`{}`))
+	require.EqualError(t, err, "kind 'Deployment' is not supported")
+}
+
+func TestDecodeVMObjectReplicas(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		replicas int
+	}{
+		{fixture: "../test_data/virtualmachine.json", replicas: 1},
+		{fixture: "../test_data/virtualmachineinstance.json", replicas: 1},
+		{fixture: "../test_data/virtualmachinepool.json", replicas: 2},
+		{fixture: "../test_data/virtualmachinetemplateversion.json", replicas: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			data, err := os.ReadFile(tt.fixture)
+			require.NoError(t, err)
+
+			request := kubewardenProtocol.KubernetesAdmissionRequest{}
+			require.NoError(t, json.Unmarshal(data, &request))
+
+			object, err := decodeVMObject(request.Kind, request.Object)
+			require.NoError(t, err)
+			assert.Equal(t, request.Kind.Kind, object.kind)
+			assert.Equal(t, tt.replicas, object.replicas)
+			assert.Len(t, object.vm.Spec.Template.Spec.Networks, 1)
+		})
+	}
+}
+
+func TestDecodeVMObjectPoolWithoutReplicas(t *testing.T) {
+	kind := kubewardenProtocol.GroupVersionKind{Group: "pool.kubevirt.io", Version: "v1alpha1", Kind: "VirtualMachinePool"}
+	object, err := decodeVMObject(kind, json.RawMessage(`{"spec":{}}`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, object.replicas)
+}
+
+func TestDecodeVMObjectOwnedVMI(t *testing.T) {
+	kind := kubewardenProtocol.GroupVersionKind{Group: "kubevirt.io", Version: "v1", Kind: "VirtualMachineInstance"}
+	tests := []struct {
+		name      string
+		object    string
+		ownedByVM bool
+	}{
+		{name: "standalone", object: `{"metadata":{"name":"vmi-1"}}`},
+		{
+			name:      "owned by a VM",
+			object:    `{"metadata":{"name":"vm-1","ownerReferences":[{"kind":"VirtualMachine","name":"vm-1"}]}}`,
+			ownedByVM: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object, err := decodeVMObject(kind, json.RawMessage(tt.object))
+			require.NoError(t, err)
+			assert.Equal(t, tt.ownedByVM, object.ownedByVM)
+		})
+	}
+}
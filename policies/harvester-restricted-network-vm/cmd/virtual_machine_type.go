@@ -9,11 +9,41 @@ type multus struct {
 	NetworkName string `json:"networkName"`
 }
 
+// podNetwork is the default pod network, it has no fields.
+type podNetwork struct{}
+
+// vmNetwork is a network of the VM, from either the pod network or a multus network.
 type vmNetwork struct {
-	Multus multus `json:"multus"`
+	Name   string      `json:"name,omitempty"`
+	Pod    *podNetwork `json:"pod,omitempty"`
+	Multus multus      `json:"multus"`
+}
+
+// vmInterfaceBindingPlugin is a network binding plugin, e.g. "passt".
+type vmInterfaceBindingPlugin struct {
+	Name string `json:"name"`
+}
+
+// vmInterface is an interface of the VM, connected to the network of the same name with one binding method.
+type vmInterface struct {
+	Name       string                    `json:"name"`
+	Bridge     *struct{}                 `json:"bridge,omitempty"`
+	Masquerade *struct{}                 `json:"masquerade,omitempty"`
+	SRIOV      *struct{}                 `json:"sriov,omitempty"`
+	Binding    *vmInterfaceBindingPlugin `json:"binding,omitempty"`
+	MacAddress string                    `json:"macAddress,omitempty"`
+}
+
+type vmDevices struct {
+	Interfaces []vmInterface `json:"interfaces"`
+}
+
+type vmDomain struct {
+	Devices vmDevices `json:"devices"`
 }
 
 type vmNetworks struct {
+	Domain   vmDomain    `json:"domain"`
 	Networks []vmNetwork `json:"networks"`
 }
 
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-restricted-network-vm/internal/logger"
+	"github.com/francoispqt/onelog"
+)
+
+const (
+	minVLAN = 1
+	maxVLAN = 4094
+	// untaggedVLAN is the VLAN of an untagged network, which is never a valid VLAN ID.
+	untaggedVLAN = 0
+)
+
+// NamespaceVLANBinding binds VLANs to a namespace, like the namespaceVLANBindings of harvester-restricted-network,
+// so that both policies can share them.
+type NamespaceVLANBinding struct {
+	Namespace string `json:"namespace"`
+	VLAN      int    `json:"vlan,omitempty"`
+	// VLANs are VLANs, e.g. "310", or VLAN ranges, e.g. "200-299".
+	VLANs []string `json:"vlans,omitempty"`
+	// Untagged binds the untagged network.
+	Untagged bool `json:"untagged,omitempty"`
+	// ClusterNetwork limits the VLANs to a cluster network, they're bound on every cluster network when empty.
+	ClusterNetwork string `json:"clusterNetwork,omitempty"`
+}
+
+// ReservedVLANs are VLANs that only system namespaces can use, like the reservedVLANs of
+// harvester-restricted-network, e.g. the storage network of harvester-system.
+type ReservedVLANs struct {
+	// VLANs are VLANs, e.g. "310", or VLAN ranges, e.g. "200-299".
+	VLANs []string `json:"vlans,omitempty"`
+	// Untagged reserves the untagged network.
+	Untagged   bool     `json:"untagged,omitempty"`
+	Namespaces []string `json:"namespaces"`
+}
+
+// vlanRange is an inclusive range of VLAN IDs, a single VLAN has the same start and end.
+type vlanRange struct {
+	start int
+	end   int
+}
+
+// parseVLANRange parses a VLAN, e.g. "310", or a VLAN range, e.g. "200-299".
+func parseVLANRange(value string) (vlanRange, error) {
+	startValue, endValue, isRange := strings.Cut(strings.TrimSpace(value), "-")
+	if !isRange {
+		endValue = startValue
+	}
+
+	start, err := strconv.Atoi(strings.TrimSpace(startValue))
+	if err != nil {
+		return vlanRange{}, fmt.Errorf("'%s' is not a VLAN or a VLAN range", value)
+	}
+
+	end, err := strconv.Atoi(strings.TrimSpace(endValue))
+	if err != nil {
+		return vlanRange{}, fmt.Errorf("'%s' is not a VLAN or a VLAN range", value)
+	}
+
+	r := vlanRange{start: start, end: end}
+	return r, r.validate()
+}
+
+func (r vlanRange) validate() error {
+	if !isVLAN(r.start) || !isVLAN(r.end) {
+		return fmt.Errorf("VLANs %s are out of range %d-%d", r, minVLAN, maxVLAN)
+	}
+
+	if r.start > r.end {
+		return fmt.Errorf("VLANs %s start after they end", r)
+	}
+
+	return nil
+}
+
+func isVLAN(vlan int) bool {
+	return vlan >= minVLAN && vlan <= maxVLAN
+}
+
+func (r vlanRange) String() string {
+	if r.start == r.end {
+		return strconv.Itoa(r.start)
+	}
+
+	return fmt.Sprintf("%d-%d", r.start, r.end)
+}
+
+// vlanName returns the ID of a VLAN, or "untagged" for the untagged network.
+func vlanName(vlan int) string {
+	if vlan == untaggedVLAN {
+		return "untagged"
+	}
+
+	return strconv.Itoa(vlan)
+}
+
+// name is like String, but says "untagged" for the untagged network.
+func (r vlanRange) name() string {
+	if r.start == untaggedVLAN && r.end == untaggedVLAN {
+		return vlanName(untaggedVLAN)
+	}
+
+	return r.String()
+}
+
+func (r vlanRange) overlaps(other vlanRange) bool {
+	return r.start <= other.end && other.start <= r.end
+}
+
+func (r vlanRange) contains(vlan int) bool {
+	return r.start <= vlan && vlan <= r.end
+}
+
+// vlanOwner is a namespace that a VLAN is bound to, on a cluster network or on any of them when empty.
+type vlanOwner struct {
+	namespace      string
+	clusterNetwork string
+}
+
+func (b *NamespaceVLANBinding) owner() vlanOwner {
+	return vlanOwner{namespace: b.Namespace, clusterNetwork: b.ClusterNetwork}
+}
+
+type indexedVLANRange struct {
+	index     int
+	vlanRange vlanRange
+}
+
+// bindingRanges returns the valid ranges of a binding, and a problem for each invalid one.
+// The untagged network is the range 0-0.
+func bindingRanges(i int, binding *NamespaceVLANBinding) ([]vlanRange, []string) {
+	ranges := []vlanRange{}
+	problems := []string{}
+
+	if binding.Untagged {
+		ranges = append(ranges, vlanRange{start: untaggedVLAN, end: untaggedVLAN})
+	}
+
+	if binding.VLAN != 0 {
+		r := vlanRange{start: binding.VLAN, end: binding.VLAN}
+		if err := r.validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("namespaceVLANBindings[%d].vlan: %v", i, err))
+		} else {
+			ranges = append(ranges, r)
+		}
+	}
+
+	for j, value := range binding.VLANs {
+		r, err := parseVLANRange(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("namespaceVLANBindings[%d].vlans[%d]: %v", i, j, err))
+			continue
+		}
+		ranges = append(ranges, r)
+	}
+
+	return ranges, problems
+}
+
+// vlanBindingProblems ensures that every binding is complete, and doesn't bind reserved VLANs to other namespaces.
+//
+// Ranges of a namespace on a cluster network must not overlap, but ranges of different namespaces can, to share VLANs.
+// The problems are the ones of harvester-restricted-network, the tests of both policies read
+// test_data/vlan_bindings.json.
+func (s *Settings) vlanBindingProblems() []string {
+	problems := []string{}
+	seen := map[vlanOwner][]indexedVLANRange{}
+
+	for i, binding := range s.NamespaceVLANBindings {
+		if binding.Namespace == "" || (binding.VLAN == 0 && len(binding.VLANs) == 0 && !binding.Untagged) {
+			problems = append(problems,
+				fmt.Sprintf("namespaceVLANBindings[%d]: namespace and vlan, vlans or untagged must be specified", i))
+			continue
+		}
+
+		ranges, rangeProblems := bindingRanges(i, &binding)
+		problems = append(problems, rangeProblems...)
+
+		for _, r := range ranges {
+			if problem, ok := s.reservedOverlapProblem(i, binding.Namespace, r); ok {
+				problems = append(problems, problem)
+				continue
+			}
+
+			if problem, ok := overlapProblem(i, r, seen[binding.owner()]); ok {
+				problems = append(problems, problem)
+				continue
+			}
+			seen[binding.owner()] = append(seen[binding.owner()], indexedVLANRange{index: i, vlanRange: r})
+		}
+	}
+
+	return problems
+}
+
+// overlapProblem checks a range against the ranges already bound to the same namespace and cluster network.
+func overlapProblem(i int, r vlanRange, seen []indexedVLANRange) (string, bool) {
+	for _, other := range seen {
+		switch {
+		case !r.overlaps(other.vlanRange):
+			continue
+		case other.index == i:
+			return fmt.Sprintf("namespaceVLANBindings[%d]: VLANs %s overlap VLANs %s",
+				i, r, other.vlanRange), true
+		case r == other.vlanRange:
+			return fmt.Sprintf("namespaceVLANBindings[%d]: duplicate of namespaceVLANBindings[%d]",
+				i, other.index), true
+		default:
+			return fmt.Sprintf("namespaceVLANBindings[%d]: VLANs %s overlap VLANs %s of namespaceVLANBindings[%d]",
+				i, r, other.vlanRange, other.index), true
+		}
+	}
+
+	return "", false
+}
+
+// ranges returns the valid reserved VLAN ranges, the untagged network is the range 0-0.
+// Invalid VLANs are reported by reservedProblems.
+func (r *ReservedVLANs) ranges() []vlanRange {
+	ranges := []vlanRange{}
+	for _, value := range r.VLANs {
+		if reservedRange, err := parseVLANRange(value); err == nil {
+			ranges = append(ranges, reservedRange)
+		}
+	}
+
+	if r.Untagged {
+		ranges = append(ranges, vlanRange{start: untaggedVLAN, end: untaggedVLAN})
+	}
+
+	return ranges
+}
+
+// reservedProblems ensures that every reserved VLAN is valid and has system namespaces.
+func (s *Settings) reservedProblems() []string {
+	problems := []string{}
+	for i, reserved := range s.ReservedVLANs {
+		if (len(reserved.VLANs) == 0 && !reserved.Untagged) ||
+			len(reserved.Namespaces) == 0 || slices.Contains(reserved.Namespaces, "") {
+			problems = append(problems,
+				fmt.Sprintf("reservedVLANs[%d]: vlans or untagged, and namespaces must be specified", i))
+			continue
+		}
+
+		for j, value := range reserved.VLANs {
+			if _, err := parseVLANRange(value); err != nil {
+				problems = append(problems, fmt.Sprintf("reservedVLANs[%d].vlans[%d]: %v", i, j, err))
+			}
+		}
+	}
+
+	return problems
+}
+
+// reservedOverlapProblem checks that a VLAN range bound to a namespace isn't reserved for other namespaces.
+func (s *Settings) reservedOverlapProblem(i int, namespace string, r vlanRange) (string, bool) {
+	for j, reserved := range s.ReservedVLANs {
+		if slices.Contains(reserved.Namespaces, namespace) {
+			continue
+		}
+
+		for _, reservedRange := range reserved.ranges() {
+			if r.overlaps(reservedRange) {
+				return fmt.Sprintf("namespaceVLANBindings[%d]: VLANs %s overlap reserved VLANs %s of reservedVLANs[%d]",
+					i, r.name(), reservedRange.name(), j), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// reservedFor returns the system namespaces that a VLAN is reserved for.
+func (s *Settings) reservedFor(vlan int) ([]string, bool) {
+	for _, reserved := range s.ReservedVLANs {
+		for _, reservedRange := range reserved.ranges() {
+			if reservedRange.contains(vlan) {
+				return reserved.Namespaces, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// resolvesNetworks checks whether the networks of a VM are resolved to their VLANs.
+func (s *Settings) resolvesNetworks() bool {
+	return len(s.NamespaceVLANBindings) > 0 || len(s.ReservedVLANs) > 0
+}
+
+// isVLANAllowed verifies if a namespace can use a VLAN on a cluster network, like harvester-restricted-network:
+//   - a reserved VLAN can only be used by its system namespaces, whatever the bindings
+//   - a VLAN bound on the cluster network can only be used by the namespaces bound to it
+//   - a namespace with VLAN bindings can only use its VLANs
+//   - a VLAN and a namespace without bindings are unrestricted
+func (s *Settings) isVLANAllowed(ctx context.Context, namespace, clusterNetwork string, vlan int) bool {
+	owners := []string{}
+	namespaceBound := false
+	systemNamespaces, reserved := s.reservedFor(vlan)
+
+	for i, binding := range s.NamespaceVLANBindings {
+		namespaceBound = namespaceBound || binding.Namespace == namespace
+
+		if binding.ClusterNetwork != "" && binding.ClusterNetwork != clusterNetwork {
+			continue
+		}
+
+		// invalid ranges are rejected with the settings
+		ranges, _ := bindingRanges(i, &binding)
+		if slices.ContainsFunc(ranges, func(r vlanRange) bool { return r.contains(vlan) }) {
+			owners = append(owners, binding.Namespace)
+		}
+	}
+
+	allowed := !namespaceBound
+	switch {
+	case reserved:
+		allowed = slices.Contains(systemNamespaces, namespace)
+	case len(owners) > 0:
+		allowed = slices.Contains(owners, namespace)
+	}
+
+	logger.FromContext(ctx).DebugWithFields("VLAN checked", func(e onelog.Entry) {
+		e.String("namespace", namespace)
+		e.String("clusterNetwork", clusterNetwork)
+		e.Int("vlan", vlan)
+		e.Bool("allowed", allowed)
+	})
+
+	return allowed
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVLANBindingProblems(t *testing.T) {
+	settings := Settings{
+		NamespaceVLANBindings: []NamespaceVLANBinding{
+			{Namespace: "namespace-1", VLAN: 42},
+			{Namespace: "namespace-2", VLANs: []string{"200-299", "310"}, ClusterNetwork: "data"},
+			{Namespace: "namespace-3", Untagged: true},
+			{Namespace: "namespace-4"},
+			{VLAN: 42},
+			{Namespace: "namespace-5", VLAN: 4095},
+			{Namespace: "namespace-5", VLANs: []string{"300-200"}},
+			{Namespace: "namespace-5", VLANs: []string{"vlan"}},
+			{Namespace: "namespace-6", VLANs: []string{"3990-4010"}},
+			{Namespace: "harvester-system", VLANs: []string{"4000"}},
+		},
+		ReservedVLANs: []ReservedVLANs{
+			{VLANs: []string{"4000-4094"}, Namespaces: []string{"harvester-system"}},
+		},
+	}
+
+	assert.Equal(t, []string{
+		"namespaceVLANBindings[3]: namespace and vlan, vlans or untagged must be specified",
+		"namespaceVLANBindings[4]: namespace and vlan, vlans or untagged must be specified",
+		"namespaceVLANBindings[5].vlan: VLANs 4095 are out of range 1-4094",
+		"namespaceVLANBindings[6].vlans[0]: VLANs 300-200 start after they end",
+		"namespaceVLANBindings[7].vlans[0]: 'vlan' is not a VLAN or a VLAN range",
+		"namespaceVLANBindings[8]: VLANs 3990-4010 overlap reserved VLANs 4000-4094 of reservedVLANs[0]",
+	}, settings.vlanBindingProblems())
+}
+
+// sharedVLANBindingCase is a case of test_data/vlan_bindings.json, which harvester-restricted-network checks too.
+type sharedVLANBindingCase struct {
+	Name     string          `json:"name"`
+	Settings json.RawMessage `json:"settings"`
+	Problems []string        `json:"problems"`
+}
+
+func TestSharedVLANBindings(t *testing.T) {
+	data, err := os.ReadFile("../test_data/vlan_bindings.json")
+	require.NoError(t, err)
+
+	cases := []sharedVLANBindingCase{}
+	require.NoError(t, json.Unmarshal(data, &cases))
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			settings, err := parseSettings(tc.Settings)
+			require.NoError(t, err)
+
+			_, err = settings.valid()
+			if len(tc.Problems) == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			var settingsError *SettingsError
+			require.ErrorAs(t, err, &settingsError)
+			assert.Equal(t, tc.Problems, settingsError.Problems)
+		})
+	}
+}
+
+func TestReservedProblems(t *testing.T) {
+	settings := Settings{
+		NamespaceVLANBindings: []NamespaceVLANBinding{
+			{Namespace: "namespace-1", Untagged: true},
+		},
+		ReservedVLANs: []ReservedVLANs{
+			{VLANs: []string{"1", "4000-4094"}, Namespaces: []string{"harvester-system"}},
+			{Untagged: true, Namespaces: []string{"harvester-system"}},
+			{VLANs: []string{"0"}, Namespaces: []string{"harvester-system"}},
+			{VLANs: []string{"1"}},
+		},
+	}
+
+	assert.Equal(t, []string{
+		"reservedVLANs[2].vlans[0]: VLANs 0 are out of range 1-4094",
+		"reservedVLANs[3]: vlans or untagged, and namespaces must be specified",
+	}, settings.reservedProblems())
+	assert.Equal(t, []string{
+		"namespaceVLANBindings[0]: VLANs untagged overlap reserved VLANs untagged of reservedVLANs[1]",
+	}, settings.vlanBindingProblems())
+}
+
+func TestIsVLANAllowed(t *testing.T) {
+	ctx := context.Background()
+	settings := Settings{
+		NamespaceVLANBindings: []NamespaceVLANBinding{
+			{Namespace: "namespace-1", VLAN: 42},
+			{Namespace: "namespace-2", VLAN: 42},
+			{Namespace: "namespace-3", VLANs: []string{"200-299"}, ClusterNetwork: "data"},
+			{Namespace: "namespace-4", Untagged: true},
+			{Namespace: "namespace-5", VLAN: 4000},
+		},
+		ReservedVLANs: []ReservedVLANs{
+			{VLANs: []string{"4000-4094"}, Namespaces: []string{"harvester-system"}},
+			{Untagged: true, Namespaces: []string{"harvester-system"}},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		namespace      string
+		clusterNetwork string
+		vlan           int
+		allowed        bool
+	}{
+		{name: "bound VLAN", namespace: "namespace-1", clusterNetwork: "mgmt", vlan: 42, allowed: true},
+		{name: "VLAN shared by namespaces", namespace: "namespace-2", clusterNetwork: "data", vlan: 42, allowed: true},
+		{name: "VLAN of a range", namespace: "namespace-3", clusterNetwork: "data", vlan: 250, allowed: true},
+		{name: "range on another cluster network", namespace: "namespace-3", clusterNetwork: "mgmt", vlan: 250},
+		{name: "VLAN of another namespace", namespace: "namespace-3", clusterNetwork: "data", vlan: 42},
+		{name: "bound namespace, unbound VLAN", namespace: "namespace-1", clusterNetwork: "mgmt", vlan: 100},
+		{name: "reserved VLAN", namespace: "harvester-system", clusterNetwork: "mgmt", vlan: 4001, allowed: true},
+		{name: "reserved VLAN of another namespace", namespace: "random-namespace", clusterNetwork: "mgmt", vlan: 4001},
+		{name: "reserved VLAN bound to a namespace", namespace: "namespace-5", clusterNetwork: "mgmt", vlan: 4000},
+		{
+			name: "reserved untagged network", namespace: "harvester-system", clusterNetwork: "mgmt", vlan: 0,
+			allowed: true,
+		},
+		{
+			name: "reserved untagged network bound to a namespace", namespace: "namespace-4", clusterNetwork: "mgmt",
+			vlan: 0,
+		},
+		{name: "unrestricted", namespace: "random-namespace", clusterNetwork: "mgmt", vlan: 100, allowed: true},
+		{name: "bound VLAN, unbound namespace", namespace: "random-namespace", clusterNetwork: "data", vlan: 250},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.allowed, settings.isVLANAllowed(ctx, tt.namespace, tt.clusterNetwork, tt.vlan))
+		})
+	}
+}
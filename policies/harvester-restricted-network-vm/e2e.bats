@@ -1 +1,85 @@
 #!/usr/bin/env bats
+
+@test "accept a VirtualMachine because the network is bound to the namespace" {
+  run kwctl run annotated-policy.wasm -r test_data/virtualmachine.json --settings-json '{"namespaceNetworkBindings": [{"namespace": "default", "network": "vlan-42"}]}'
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  # request accepted
+  [ "$status" -eq 0 ]
+  [ "$(expr "$output" : '.*allowed.*true')" -ne 0 ]
+}
+
+@test "reject a VirtualMachine because the network is bound to another namespace" {
+  run kwctl run annotated-policy.wasm -r test_data/virtualmachine.json --settings-json '{"namespaceNetworkBindings": [{"namespace": "restricted-namespace", "network": "default/vlan-42"}]}'
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  # request rejected
+  [ "$status" -eq 0 ]
+  [ "$(expr "$output" : '.*allowed.*false')" -ne 0 ]
+  [ "$(expr "$output" : ".*Network 'default/vlan-42' is not allowed for namespace: 'default'.*")" -ne 0 ]
+}
+
+@test "accept a VirtualMachineInstance because the network is bound to the namespace" {
+  run kwctl run annotated-policy.wasm -r test_data/virtualmachineinstance.json --settings-json '{"namespaceNetworkBindings": [{"namespace": "default", "network": "vlan-42"}]}'
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  # request accepted
+  [ "$status" -eq 0 ]
+  [ "$(expr "$output" : '.*allowed.*true')" -ne 0 ]
+}
+
+@test "reject a VirtualMachineInstance because the network is bound to another namespace" {
+  run kwctl run annotated-policy.wasm -r test_data/virtualmachineinstance.json --settings-json '{"namespaceNetworkBindings": [{"namespace": "restricted-namespace", "network": "default/vlan-42"}]}'
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  # request rejected
+  [ "$status" -eq 0 ]
+  [ "$(expr "$output" : '.*allowed.*false')" -ne 0 ]
+  [ "$(expr "$output" : ".*Network 'default/vlan-42' is not allowed for namespace: 'default'.*")" -ne 0 ]
+}
+
+@test "accept a VirtualMachinePool because the network is bound to the namespace" {
+  run kwctl run annotated-policy.wasm -r test_data/virtualmachinepool.json --settings-json '{"namespaceNetworkBindings": [{"namespace": "default", "network": "vlan-42"}]}'
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  # request accepted
+  [ "$status" -eq 0 ]
+  [ "$(expr "$output" : '.*allowed.*true')" -ne 0 ]
+}
+
+@test "reject a VirtualMachinePool because the network is bound to another namespace" {
+  run kwctl run annotated-policy.wasm -r test_data/virtualmachinepool.json --settings-json '{"namespaceNetworkBindings": [{"namespace": "restricted-namespace", "network": "default/vlan-42"}]}'
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  # request rejected
+  [ "$status" -eq 0 ]
+  [ "$(expr "$output" : '.*allowed.*false')" -ne 0 ]
+  [ "$(expr "$output" : ".*Network 'default/vlan-42' is not allowed for namespace: 'default'.*")" -ne 0 ]
+}
+
+@test "accept a VirtualMachineTemplateVersion because the network is bound to the namespace" {
+  run kwctl run annotated-policy.wasm -r test_data/virtualmachinetemplateversion.json --settings-json '{"namespaceNetworkBindings": [{"namespace": "default", "network": "vlan-42"}]}'
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  # request accepted
+  [ "$status" -eq 0 ]
+  [ "$(expr "$output" : '.*allowed.*true')" -ne 0 ]
+}
+
+@test "reject a VirtualMachineTemplateVersion because the network is bound to another namespace" {
+  run kwctl run annotated-policy.wasm -r test_data/virtualmachinetemplateversion.json --settings-json '{"namespaceNetworkBindings": [{"namespace": "restricted-namespace", "network": "default/vlan-42"}]}'
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  # request rejected
+  [ "$status" -eq 0 ]
+  [ "$(expr "$output" : '.*allowed.*false')" -ne 0 ]
+  [ "$(expr "$output" : ".*Network 'default/vlan-42' is not allowed for namespace: 'default'.*")" -ne 0 ]
+}
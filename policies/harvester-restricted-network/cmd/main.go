@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 
 	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-restricted-network/internal"
 	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-restricted-network/internal/logger"
@@ -25,11 +24,5 @@ func main() {
 }
 
 func parseSettings(payload []byte) (internal.Settings, error) {
-	settings := internal.Settings{}
-	err := json.Unmarshal(payload, &settings)
-	if err != nil {
-		return internal.Settings{}, err
-	}
-
-	return settings, nil
+	return internal.NewSettingsFromJSON(payload)
 }
@@ -3,11 +3,14 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
 
 	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-restricted-network/internal"
 	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-restricted-network/internal/logger"
 	"github.com/francoispqt/onelog"
 	kubewarden "github.com/kubewarden/policy-sdk-go"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
 	kubewardenProtocol "github.com/kubewarden/policy-sdk-go/protocol"
 )
 
@@ -27,6 +30,10 @@ func validateRequest(ctx context.Context, payload []byte) ([]byte, error) {
 			kubewarden.Code(httpBadRequestStatusCode))
 	}
 
+	if validationRequest.Request.Operation == deleteOperation {
+		return validateDeleteRequest(ctx, &settings, &validationRequest)
+	}
+
 	networkAttachmentDefinition := internal.NetworkAttachmentDefinition{}
 	err = json.Unmarshal(validationRequest.Request.Object, &networkAttachmentDefinition)
 	if err != nil {
@@ -35,19 +42,212 @@ func validateRequest(ctx context.Context, payload []byte) ([]byte, error) {
 			kubewarden.Code(httpBadRequestStatusCode))
 	}
 
+	if settings.StrictConfigName {
+		err = networkAttachmentDefinition.ValidateName()
+		if err != nil {
+			return kubewarden.RejectRequest(
+				kubewarden.Message(err.Error()),
+				kubewarden.Code(httpBadRequestStatusCode))
+		}
+	}
+
 	namespace := networkAttachmentDefinition.Metadata.Namespace
-	vlan := networkAttachmentDefinition.Spec.Config.VLAN
 	l := logger.FromContext(ctx).With(func(entry onelog.Entry) {
 		entry.String("namespace", namespace)
-		entry.Int("vlan", vlan)
 	})
 
 	l.Info("NETWORK_CHECK namespace")
-	if !settings.IsVLANAllowed(ctx, namespace, vlan) {
-		l.Info("NETWORK_REJECTED namespace")
-		return kubewarden.RejectRequest("Invalid request", kubewarden.Code(httpBadRequestStatusCode))
+	rejection, err := networkAttachmentDefinitionRejection(ctx, l, &settings, &networkAttachmentDefinition)
+	if err != nil {
+		return kubewarden.RejectRequest(
+			kubewarden.Message(err.Error()),
+			kubewarden.Code(httpBadRequestStatusCode))
+	}
+
+	if rejection != "" {
+		return kubewarden.RejectRequest(kubewarden.Message(rejection), kubewarden.Code(httpBadRequestStatusCode))
 	}
 	l.Info("NETWORK_ALLOWED namespace")
 
 	return kubewarden.AcceptRequest()
 }
+
+// networkAttachmentDefinitionRejection checks the CNI types, the networks and the subnets of every plugin.
+// It returns why the request is rejected, or an empty string when it's allowed,
+// and an error when they cannot be worked out.
+func networkAttachmentDefinitionRejection(
+	ctx context.Context,
+	l *onelog.Logger,
+	settings *internal.Settings,
+	networkAttachmentDefinition *internal.NetworkAttachmentDefinition,
+) (string, error) {
+	namespace := networkAttachmentDefinition.Metadata.Namespace
+
+	for _, cniType := range networkAttachmentDefinition.Spec.Config.Types() {
+		if !settings.IsCNITypeAllowed(ctx, namespace, cniType) {
+			l.InfoWithFields("NETWORK_REJECTED namespace", func(entry onelog.Entry) {
+				entry.String("type", cniType)
+			})
+			return fmt.Sprintf("CNI type '%s' is not allowed for namespace '%s'", cniType, namespace), nil
+		}
+	}
+
+	// a configuration list can carry a VLAN in each of its plugins, and a trunk carries many VLANs
+	networks, err := networkAttachmentDefinition.Networks()
+	if err != nil {
+		return "", err
+	}
+
+	err = networkAttachmentDefinition.ValidateNetworkType(networks)
+	if err != nil {
+		return "", err
+	}
+
+	for _, network := range networks {
+		nl := l.With(func(entry onelog.Entry) {
+			entry.String("clusterNetwork", network.ClusterNetwork)
+			entry.Int("vlan", network.VLAN)
+			entry.Bool("trunk", network.Trunk)
+		})
+
+		if network.Trunk && !settings.IsVLANTrunkAllowed(namespace) {
+			nl.Info("NETWORK_REJECTED namespace")
+			return fmt.Sprintf("namespace '%s' cannot use VLAN trunks", namespace), nil
+		}
+
+		decision := settings.IsVLANAllowed(ctx, namespace, network.ClusterNetwork, network.VLAN)
+		if !decision.Allowed {
+			nl.InfoWithFields("NETWORK_REJECTED namespace", func(entry onelog.Entry) {
+				entry.String("reason", string(decision.Reason))
+			})
+			return decision.String(), nil
+		}
+	}
+
+	if settings.UniqueVLANs {
+		rejection, err := networkConflictRejection(l, settings, namespace, networks)
+		if rejection != "" || err != nil {
+			return rejection, err
+		}
+	}
+
+	return subnetRejection(ctx, l, settings, networkAttachmentDefinition)
+}
+
+// subnetRejection checks the IPAM subnets of every plugin, and the CIDR and the gateway of the route annotation.
+func subnetRejection(
+	ctx context.Context,
+	l *onelog.Logger,
+	settings *internal.Settings,
+	networkAttachmentDefinition *internal.NetworkAttachmentDefinition,
+) (string, error) {
+	namespace := networkAttachmentDefinition.Metadata.Namespace
+
+	subnets, err := networkAttachmentDefinition.Spec.Config.Subnets()
+	if err != nil {
+		return "", err
+	}
+
+	for _, subnet := range subnets {
+		if !settings.IsSubnetAllowed(ctx, namespace, subnet) {
+			l.InfoWithFields("NETWORK_REJECTED namespace", func(entry onelog.Entry) {
+				entry.String("subnet", subnet.String())
+			})
+			return fmt.Sprintf("subnet %s is not allowed for namespace '%s'", subnet, namespace), nil
+		}
+	}
+
+	route, ok, err := networkAttachmentDefinition.Route()
+	if err != nil || !ok {
+		return "", err
+	}
+
+	routeSubnets, err := route.Subnets()
+	if err != nil {
+		return "", err
+	}
+
+	for _, subnet := range routeSubnets {
+		if !settings.IsSubnetAllowed(ctx, namespace, subnet) {
+			l.InfoWithFields("NETWORK_REJECTED namespace", func(entry onelog.Entry) {
+				entry.String("routeSubnet", subnet.String())
+			})
+			return fmt.Sprintf("route subnet %s is not allowed for namespace '%s'", subnet, namespace), nil
+		}
+	}
+
+	return "", nil
+}
+
+// networkConflictRejection rejects the networks that NetworkAttachmentDefinitions of other namespaces already use.
+func networkConflictRejection(
+	l *onelog.Logger,
+	settings *internal.Settings,
+	namespace string,
+	networks []internal.Network,
+) (string, error) {
+	host := capabilities.NewHost()
+	conflict, found, err := settings.FindNetworkConflict(&host, namespace, networks)
+	if err != nil {
+		return "", err
+	}
+
+	if !found {
+		return "", nil
+	}
+
+	l.InfoWithFields("NETWORK_REJECTED namespace", func(entry onelog.Entry) {
+		entry.String("conflict", conflict.String())
+	})
+	return conflict.String(), nil
+}
+
+const deleteOperation = "DELETE"
+
+// validateDeleteRequest rejects the deletion of a NetworkAttachmentDefinition that VirtualMachines still use,
+// when ProtectNetworksInUse is set.
+func validateDeleteRequest(
+	ctx context.Context,
+	settings *internal.Settings,
+	validationRequest *kubewardenProtocol.ValidationRequest,
+) ([]byte, error) {
+	if !settings.ProtectNetworksInUse {
+		return kubewarden.AcceptRequest()
+	}
+
+	networkAttachmentDefinition := internal.NetworkAttachmentDefinition{}
+	err := json.Unmarshal(validationRequest.Request.OldObject, &networkAttachmentDefinition)
+	if err != nil {
+		return kubewarden.RejectRequest(
+			kubewarden.Message(err.Error()),
+			kubewarden.Code(httpBadRequestStatusCode))
+	}
+
+	namespace := networkAttachmentDefinition.Metadata.Namespace
+	name := networkAttachmentDefinition.Metadata.Name
+	l := logger.FromContext(ctx).With(func(entry onelog.Entry) {
+		entry.String("namespace", namespace)
+		entry.String("name", name)
+	})
+
+	host := capabilities.NewHost()
+	users, err := internal.FindNetworkUsers(&host, namespace, name)
+	if err != nil {
+		return kubewarden.RejectRequest(
+			kubewarden.Message(err.Error()),
+			kubewarden.Code(httpBadRequestStatusCode))
+	}
+
+	if len(users) > 0 {
+		l.InfoWithFields("NETWORK_DELETE_REJECTED namespace", func(entry onelog.Entry) {
+			entry.String("virtualMachines", strings.Join(users, ", "))
+		})
+		return kubewarden.RejectRequest(
+			kubewarden.Message(fmt.Sprintf("NetworkAttachmentDefinition '%s/%s' is used by VirtualMachines [%s]",
+				namespace, name, strings.Join(users, ", "))),
+			kubewarden.Code(httpBadRequestStatusCode))
+	}
+	l.Info("NETWORK_DELETE_ALLOWED namespace")
+
+	return kubewarden.AcceptRequest()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-restricted-network/internal/logger"
 	kubewarden "github.com/kubewarden/policy-sdk-go"
 )
 
@@ -13,9 +14,10 @@ func validateSettings(ctx context.Context, payload []byte) ([]byte, error) {
 		return kubewarden.RejectSettings(kubewarden.Message(fmt.Sprintf("Invalid settings JSON: %v", err)))
 	}
 
-	valid := settings.IsValid(ctx)
-	if !valid {
-		return kubewarden.RejectSettings("Invalid settings")
+	err = settings.Validate()
+	if err != nil {
+		logger.FromContext(ctx).Info(fmt.Sprintf("Invalid settings: %v", err))
+		return kubewarden.RejectSettings(kubewarden.Message(fmt.Sprintf("Invalid settings: %v", err)))
 	}
 
 	return kubewarden.AcceptSettings()
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// networkExtractor works out the networks of a plugin, from the fields its CNI type uses.
+// A plugin without a VLAN or an underlay returns no network.
+type networkExtractor func(plugin *Plugin, defaultClusterNetwork string) ([]Network, error)
+
+// newNetworkExtractors returns the extractor of every supported CNI type.
+// Other types are read like the bridge plugin, from their `bridge`, `vlan` and `vlanTrunk` fields.
+func newNetworkExtractors() map[string]networkExtractor {
+	return map[string]networkExtractor{
+		"bridge":   extractBridgeNetworks,
+		"sriov":    extractSRIOVNetworks,
+		"macvlan":  extractMasterNetworks,
+		"ipvlan":   extractMasterNetworks,
+		"kube-ovn": extractKubeOVNNetworks,
+	}
+}
+
+// extractBridgeNetworks reads the VLAN and the VLAN trunk of a bridge port.
+func extractBridgeNetworks(plugin *Plugin, defaultClusterNetwork string) ([]Network, error) {
+	clusterNetwork := bridgeClusterNetwork(plugin, defaultClusterNetwork)
+	if err := validateVLAN(plugin.VLAN); err != nil {
+		return nil, err
+	}
+
+	networks := []Network{}
+	if plugin.VLAN != untaggedVLAN {
+		networks = append(networks, Network{ClusterNetwork: clusterNetwork, VLAN: plugin.VLAN})
+	}
+
+	for _, entry := range plugin.VLANTrunk {
+		vlanRange, err := entry.Range()
+		if err != nil {
+			return nil, err
+		}
+
+		for vlan := vlanRange.Start; vlan <= vlanRange.End; vlan++ {
+			networks = append(networks, Network{ClusterNetwork: clusterNetwork, VLAN: vlan, Trunk: true})
+		}
+	}
+
+	return networks, nil
+}
+
+// bridgeClusterNetwork returns the cluster network of the bridge, which Harvester names after it.
+func bridgeClusterNetwork(plugin *Plugin, defaultClusterNetwork string) string {
+	if plugin.Bridge == "" {
+		return defaultClusterNetwork
+	}
+
+	return strings.TrimSuffix(plugin.Bridge, bridgeSuffix)
+}
+
+// extractSRIOVNetworks reads the VLAN that the SR-IOV virtual function is tagged with.
+// The underlay is a physical function, which is only known through the cluster network label.
+func extractSRIOVNetworks(plugin *Plugin, defaultClusterNetwork string) ([]Network, error) {
+	if err := validateVLAN(plugin.VLAN); err != nil {
+		return nil, err
+	}
+
+	if plugin.VLAN == untaggedVLAN {
+		return []Network{}, nil
+	}
+
+	return []Network{{ClusterNetwork: defaultClusterNetwork, VLAN: plugin.VLAN}}, nil
+}
+
+// validateVLAN rejects the VLANs out of range, which would otherwise be unrestricted.
+func validateVLAN(vlan int) error {
+	if vlan != untaggedVLAN && !isVLAN(vlan) {
+		return fmt.Errorf("vlan %d is out of range %d-%d", vlan, minVLAN, maxVLAN)
+	}
+
+	return nil
+}
+
+// extractMasterNetworks reads the VLAN of a macvlan or ipvlan master, e.g. 300 for "eth0.300".
+// A master on a Harvester bridge, e.g. "data-br.300", is on the cluster network of the bridge.
+func extractMasterNetworks(plugin *Plugin, defaultClusterNetwork string) ([]Network, error) {
+	parent, vlanValue, tagged := strings.Cut(plugin.Master, ".")
+	if !tagged {
+		return []Network{}, nil
+	}
+
+	vlan, err := strconv.Atoi(vlanValue)
+	if err != nil {
+		return nil, fmt.Errorf("master '%s' is not a VLAN interface", plugin.Master)
+	}
+
+	if !isVLAN(vlan) {
+		return nil, fmt.Errorf("master '%s' has a VLAN out of range %d-%d", plugin.Master, minVLAN, maxVLAN)
+	}
+
+	clusterNetwork := defaultClusterNetwork
+	if strings.HasSuffix(parent, bridgeSuffix) {
+		clusterNetwork = strings.TrimSuffix(parent, bridgeSuffix)
+	}
+
+	return []Network{{ClusterNetwork: clusterNetwork, VLAN: vlan}}, nil
+}
+
+// extractKubeOVNNetworks reads the provider of a kube-ovn network, which is its underlay.
+// kube-ovn keeps the VLAN on the Subnet, so the network itself is untagged.
+func extractKubeOVNNetworks(plugin *Plugin, _ string) ([]Network, error) {
+	if plugin.Provider == "" {
+		return []Network{}, nil
+	}
+
+	return []Network{{ClusterNetwork: plugin.Provider}}, nil
+}
+
+// VLANTrunkEntry is either a single VLAN in ID, or a range of VLANs from MinID to MaxID.
+type VLANTrunkEntry struct {
+	ID    *int `json:"id"`
+	MinID *int `json:"minID"`
+	MaxID *int `json:"maxID"`
+}
+
+// Range returns the VLANs of the entry, like the bridge plugin reads them.
+func (e *VLANTrunkEntry) Range() (VLANRange, error) {
+	var vlanRange VLANRange
+	switch {
+	case e.ID != nil && e.MinID == nil && e.MaxID == nil:
+		vlanRange = VLANRange{Start: *e.ID, End: *e.ID}
+	case e.ID == nil && e.MinID != nil && e.MaxID != nil:
+		vlanRange = VLANRange{Start: *e.MinID, End: *e.MaxID}
+	default:
+		return VLANRange{}, errors.New("a vlanTrunk entry needs either an id, or a minID and a maxID")
+	}
+
+	err := vlanRange.validate()
+	if err != nil {
+		return VLANRange{}, fmt.Errorf("invalid vlanTrunk entry: %w", err)
+	}
+
+	return vlanRange, nil
+}
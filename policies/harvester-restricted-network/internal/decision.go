@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VLANReason says why a (namespace, cluster network, VLAN) combination is allowed or denied.
+type VLANReason string
+
+const (
+	// VLANReasonBound allows a VLAN bound to the namespace.
+	VLANReasonBound VLANReason = "Bound"
+	// VLANReasonUnrestricted allows a VLAN and a namespace without bindings.
+	VLANReasonUnrestricted VLANReason = "Unrestricted"
+	// VLANReasonReserved denies a VLAN bound to other namespaces.
+	VLANReasonReserved VLANReason = "Reserved"
+	// VLANReasonNamespaceBound denies a namespace bound to other VLANs.
+	VLANReasonNamespaceBound VLANReason = "NamespaceBound"
+	// VLANReasonSystemReserved allows a reserved VLAN to its system namespaces only.
+	VLANReasonSystemReserved VLANReason = "SystemReserved"
+)
+
+// VLANDecision is the result of IsVLANAllowed, with the bindings that led to it.
+type VLANDecision struct {
+	Allowed        bool
+	Reason         VLANReason
+	Namespace      string
+	ClusterNetwork string
+	VLAN           int
+	// Owners are the namespaces that the VLAN is bound to on the cluster network, or reserved for.
+	Owners []string
+	// NamespaceVLANs are the VLANs that the namespace is bound to, e.g. "200-299" or "42 on data".
+	NamespaceVLANs []string
+}
+
+// String explains the decision, it's the message of a rejected request.
+func (d *VLANDecision) String() string {
+	vlan := "VLAN " + vlanName(d.VLAN)
+	switch d.Reason {
+	case VLANReasonBound:
+		return fmt.Sprintf("%s is bound to namespace '%s'", vlan, d.Namespace)
+	case VLANReasonUnrestricted:
+		return fmt.Sprintf("%s and namespace '%s' are unrestricted", vlan, d.Namespace)
+	case VLANReasonReserved:
+		return fmt.Sprintf("%s is reserved for namespaces [%s]", vlan, strings.Join(d.Owners, ", "))
+	case VLANReasonNamespaceBound:
+		return fmt.Sprintf("namespace '%s' is bound to VLANs [%s], not to %s",
+			d.Namespace, strings.Join(d.NamespaceVLANs, ", "), vlan)
+	case VLANReasonSystemReserved:
+		return fmt.Sprintf("%s is reserved for system namespaces [%s]", vlan, strings.Join(d.Owners, ", "))
+	default:
+		return fmt.Sprintf("%s is not allowed for namespace '%s'", vlan, d.Namespace)
+	}
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// IPAM is the IP address management of a plugin.
+//
+// The subnets are read from the fields of the whereabouts, host-local and static IPAM types.
+type IPAM struct {
+	Type string `json:"type"`
+	// Range is the whereabouts range, e.g. "192.168.2.0/24" or "192.168.2.225-192.168.2.230/28".
+	Range string `json:"range"`
+	// IPRanges are the whereabouts ranges of a multi-range IPAM, each in the form of Range.
+	IPRanges []IPAMIPRange `json:"ipRanges"`
+	// Subnet is the legacy host-local subnet.
+	Subnet string `json:"subnet"`
+	// Ranges are the host-local range sets, each a list of ranges.
+	Ranges [][]IPAMRange `json:"ranges"`
+	// Addresses are the static addresses, e.g. "10.10.0.1/24".
+	Addresses []IPAMAddress `json:"addresses"`
+}
+
+type IPAMRange struct {
+	Subnet string `json:"subnet"`
+}
+
+type IPAMIPRange struct {
+	Range string `json:"range"`
+}
+
+type IPAMAddress struct {
+	Address string `json:"address"`
+}
+
+// Subnets returns every subnet of the IPAM, a static address is returned as the subnet it belongs to.
+func (i *IPAM) Subnets() ([]netip.Prefix, error) {
+	values := []string{}
+	if i.Range != "" {
+		values = append(values, i.Range)
+	}
+	for _, r := range i.IPRanges {
+		values = append(values, r.Range)
+	}
+	if i.Subnet != "" {
+		values = append(values, i.Subnet)
+	}
+	for _, rangeSet := range i.Ranges {
+		for _, r := range rangeSet {
+			values = append(values, r.Subnet)
+		}
+	}
+	for _, address := range i.Addresses {
+		values = append(values, address.Address)
+	}
+
+	subnets := []netip.Prefix{}
+	for _, value := range values {
+		subnet, err := parseSubnet(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid '%s' IPAM subnet '%s'", i.Type, value)
+		}
+		subnets = append(subnets, subnet)
+	}
+
+	return subnets, nil
+}
+
+// parseSubnet parses a CIDR, or the whereabouts form "<start>-<end>/<bits>", whose subnet holds both addresses.
+func parseSubnet(value string) (netip.Prefix, error) {
+	start, end, isRange := strings.Cut(value, "-")
+	if !isRange {
+		subnet, err := netip.ParsePrefix(value)
+		return subnet.Masked(), err
+	}
+
+	subnet, err := netip.ParsePrefix(end)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	startAddr, err := netip.ParseAddr(start)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	subnet = subnet.Masked()
+	if !subnet.Contains(startAddr) {
+		return netip.Prefix{}, errors.New("the range start is outside of the subnet")
+	}
+
+	return subnet, nil
+}
+
+// containsSubnet checks whether a subnet is inside a prefix, both must be of the same IP family.
+func containsSubnet(prefix, subnet netip.Prefix) bool {
+	return prefix.Bits() <= subnet.Bits() && prefix.Contains(subnet.Addr())
+}
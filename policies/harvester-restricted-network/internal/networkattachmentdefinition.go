@@ -1,40 +1,223 @@
 package internal
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+)
 
+// Plugin is the configuration of a single CNI plugin.
+//
+// Only the fields that carry a VLAN or an underlay are modelled, each CNI type uses some of them.
+type Plugin struct {
+	Type        string `json:"type"`
+	Bridge      string `json:"bridge"`
+	PromiscMode bool   `json:"promiscMode"`
+	VLAN        int    `json:"vlan"`
+	// VLANTrunk are the tagged VLANs of the bridge port, on top of VLAN.
+	VLANTrunk []VLANTrunkEntry `json:"vlanTrunk"`
+	// Master is the parent interface of macvlan and ipvlan, e.g. "eth0.300".
+	Master string `json:"master"`
+	// Provider is the kube-ovn provider of the network.
+	Provider string `json:"provider"`
+	IPAM     *IPAM  `json:"ipam"`
+}
+
+// Config is either a single plugin configuration, or a configuration list with its plugins in Plugins.
 type Config struct {
-	CniVersion  string      `json:"cniVersion"`
-	Name        string      `json:"name"`
-	Type        string      `json:"type"`
-	Bridge      string      `json:"bridge"`
-	PromiscMode bool        `json:"promiscMode"`
-	VLAN        int         `json:"vlan"`
-	IPAM        interface{} `json:"ipam"`
+	CniVersion string `json:"cniVersion"`
+	Name       string `json:"name"`
+	Plugin
+	Plugins []Plugin `json:"plugins"`
+}
+
+// plugins returns the plugin of a single plugin configuration, and the plugins of a configuration list.
+func (c *Config) plugins() []Plugin {
+	plugins := []Plugin{}
+	if c.Plugin.Type != "" || len(c.Plugins) == 0 {
+		plugins = append(plugins, c.Plugin)
+	}
+
+	return append(plugins, c.Plugins...)
 }
 
+// Subnets returns the IPAM subnets of every plugin.
+func (c *Config) Subnets() ([]netip.Prefix, error) {
+	subnets := []netip.Prefix{}
+	for _, plugin := range c.plugins() {
+		if plugin.IPAM == nil {
+			continue
+		}
+
+		pluginSubnets, err := plugin.IPAM.Subnets()
+		if err != nil {
+			return nil, err
+		}
+		subnets = append(subnets, pluginSubnets...)
+	}
+
+	return subnets, nil
+}
+
+// Types returns the CNI type of every plugin.
+func (c *Config) Types() []string {
+	types := []string{}
+	for _, plugin := range c.plugins() {
+		if !slices.Contains(types, plugin.Type) {
+			types = append(types, plugin.Type)
+		}
+	}
+
+	return types
+}
+
+const clusterNetworkLabel = "network.harvesterhci.io/clusternetwork"
+
+// Harvester names the bridge of a cluster network after it, e.g. "mgmt-br" for "mgmt".
+const bridgeSuffix = "-br"
+
 type Metadata struct {
-	Namespace string `json:"namespace"`
-	Name      string `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
 }
 
 type Spec struct {
 	Config Config `json:"config"`
 }
 
+// ConfigError is a spec.config that cannot be decoded.
+// Offset is the byte offset in the config, and Path the field being decoded when it's known.
+type ConfigError struct {
+	Path   string
+	Offset int64
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Offset < 0 {
+		return fmt.Sprintf("%s: %v", e.Path, e.Err)
+	}
+
+	return fmt.Sprintf("%s: %v at byte %d", e.Path, e.Err, e.Offset)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
 // UnmarshalJSON overrides the default implementation of JSON unmarshalling.
-// This is required because the config object is a JSON string and not a JSON object.
+// This is required because the config object is usually a JSON string and not a JSON object,
+// but an embedded JSON object is accepted too.
 func (c *Config) UnmarshalJSON(data []byte) error {
-	// unmarshal the data to a string
-	var jsonString string
-	_ = json.Unmarshal(data, &jsonString)
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	if len(data) > 0 && data[0] == '"' {
+		var jsonString string
+		if err := json.Unmarshal(data, &jsonString); err != nil {
+			return &ConfigError{Path: configPath, Offset: -1, Err: err}
+		}
+		data = []byte(jsonString)
+	} else if len(data) == 0 || data[0] != '{' {
+		return &ConfigError{Path: configPath, Offset: -1, Err: errors.New("must be a JSON string or a JSON object")}
+	}
 
-	// unmarshal the json string to an object
 	// Create a new type to avoid infinite recursion
 	type C Config
-	return json.Unmarshal([]byte(jsonString), (*C)(c))
+	return configError(json.Unmarshal(data, (*C)(c)))
+}
+
+const configPath = "spec.config"
+
+// configError adds the byte offset, and the path of the field, to a decoding error.
+func configError(err error) error {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &syntaxError):
+		return &ConfigError{Path: configPath, Offset: syntaxError.Offset, Err: errors.New("invalid JSON")}
+	case errors.As(err, &typeError):
+		path := configPath
+		if typeError.Field != "" {
+			path += "." + typeError.Field
+		}
+		return &ConfigError{
+			Path:   path,
+			Offset: typeError.Offset,
+			Err:    fmt.Errorf("cannot decode a JSON %s into %s", typeError.Value, typeError.Type),
+		}
+	default:
+		return &ConfigError{Path: configPath, Offset: -1, Err: err}
+	}
 }
 
 type NetworkAttachmentDefinition struct {
 	Metadata Metadata `json:"metadata"`
 	Spec     Spec     `json:"spec"`
 }
+
+// Network is a VLAN on a Harvester cluster network.
+type Network struct {
+	ClusterNetwork string
+	VLAN           int
+	// Trunk is set for the VLANs of a VLAN trunk.
+	Trunk bool
+}
+
+// Networks returns the networks of every plugin, worked out by the extractor of its CNI type.
+//
+// The cluster network label is the default cluster network, the extractors use the underlay of the plugin
+// when it has one, because that's what the traffic actually uses.
+// A config without a VLAN is untagged, so it returns its cluster network with VLAN 0.
+func (n *NetworkAttachmentDefinition) Networks() ([]Network, error) {
+	networks := []Network{}
+	seen := map[Network]struct{}{}
+	extractors := newNetworkExtractors()
+	defaultClusterNetwork := n.Metadata.Labels[clusterNetworkLabel]
+
+	for _, plugin := range n.Spec.Config.plugins() {
+		extract, ok := extractors[plugin.Type]
+		if !ok {
+			extract = extractBridgeNetworks
+		}
+
+		pluginNetworks, err := extract(&plugin, defaultClusterNetwork)
+		if err != nil {
+			return nil, fmt.Errorf("invalid '%s' plugin: %w", plugin.Type, err)
+		}
+
+		for _, network := range pluginNetworks {
+			if _, ok := seen[network]; !ok {
+				seen[network] = struct{}{}
+				networks = append(networks, network)
+			}
+		}
+	}
+
+	if len(networks) == 0 {
+		plugins := n.Spec.Config.plugins()
+		networks = append(networks, Network{ClusterNetwork: bridgeClusterNetwork(&plugins[0], defaultClusterNetwork)})
+	}
+
+	return networks, nil
+}
+
+// ValidateName ensures that the name of the config is the name of the NetworkAttachmentDefinition.
+func (n *NetworkAttachmentDefinition) ValidateName() error {
+	if n.Spec.Config.Name != n.Metadata.Name {
+		return fmt.Errorf("%s: name '%s' differs from metadata.name '%s'",
+			configPath, n.Spec.Config.Name, n.Metadata.Name)
+	}
+
+	return nil
+}
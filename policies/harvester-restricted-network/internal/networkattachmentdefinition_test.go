@@ -2,9 +2,12 @@ package internal
 
 import (
 	"encoding/json"
+	"net/netip"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestUnmarshal(t *testing.T) {
@@ -24,4 +27,473 @@ func TestUnmarshal(t *testing.T) {
 	var networkDefinition NetworkAttachmentDefinition
 	err := json.Unmarshal([]byte(jsonString), &networkDefinition)
 	assert.NoError(t, err)
+
+	networks, err := networkDefinition.Networks()
+	assert.NoError(t, err)
+	assert.Equal(t, []Network{{ClusterNetwork: "mgmt", VLAN: 1337}}, networks)
+}
+
+func TestConfigUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        string
+		networks      []Network
+		expectedError string
+	}{
+		{
+			name:     "string config",
+			config:   `"{\"type\":\"bridge\",\"bridge\":\"mgmt-br\",\"vlan\":42}"`,
+			networks: []Network{{ClusterNetwork: "mgmt", VLAN: 42}},
+		},
+		{
+			name:     "object config",
+			config:   `{"type":"bridge","bridge":"mgmt-br","vlan":42}`,
+			networks: []Network{{ClusterNetwork: "mgmt", VLAN: 42}},
+		},
+		{
+			name:     "null config",
+			config:   `null`,
+			networks: []Network{{ClusterNetwork: "", VLAN: 0}},
+		},
+		{
+			name:          "number config",
+			config:        `42`,
+			expectedError: "spec.config: must be a JSON string or a JSON object",
+		},
+		{
+			name:          "malformed string config",
+			config:        `"{\"type\":\"bridge\",\"vlan\":42"`,
+			expectedError: "spec.config: invalid JSON at byte 26",
+		},
+		{
+			name:          "string VLAN",
+			config:        `"{\"type\":\"bridge\",\"vlan\":\"42\"}"`,
+			expectedError: "spec.config.vlan: cannot decode a JSON string into int at byte 28",
+		},
+		{
+			name:          "string VLAN in a conflist object",
+			config:        `{"plugins":[{"type":"bridge","vlan":"42"}]}`,
+			expectedError: "spec.config.plugins.0.vlan: cannot decode a JSON string into int at byte 40",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var networkDefinition NetworkAttachmentDefinition
+			err := json.Unmarshal([]byte(`{"spec":{"config":`+tt.config+`}}`), &networkDefinition)
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+
+				var configError *ConfigError
+				require.ErrorAs(t, err, &configError)
+				return
+			}
+			require.NoError(t, err)
+
+			networks, err := networkDefinition.Networks()
+			require.NoError(t, err)
+			assert.Equal(t, tt.networks, networks)
+		})
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	networkDefinition := NetworkAttachmentDefinition{
+		Metadata: Metadata{Name: "network-1"},
+		Spec:     Spec{Config: Config{Name: "network-1"}},
+	}
+	require.NoError(t, networkDefinition.ValidateName())
+
+	networkDefinition.Spec.Config.Name = "network-2"
+	require.EqualError(t, networkDefinition.ValidateName(),
+		"spec.config: name 'network-2' differs from metadata.name 'network-1'")
+}
+
+func FuzzConfigUnmarshalJSON(f *testing.F) {
+	f.Add(`{"cniVersion":"0.3.1","name":"network-1","type":"bridge","bridge":"mgmt-br","vlan":1337,"ipam":{}}`)
+	f.Add(`{"plugins":[{"type":"bridge","bridge":"data-br","vlanTrunk":[{"id":42},{"minID":100,"maxID":200}]}]}`)
+	f.Add(`{"type":"macvlan","master":"eth0.300","ipam":{"type":"static","addresses":[{"address":"10.0.0.1/24"}]}}`)
+	f.Add(`{"type":"kube-ovn","provider":"vlan.default.ovn","ipam":{"ranges":[[{"subnet":"fd00::/64"}]]}}`)
+	f.Add(`{"vlan":"42"}`)
+	f.Add(`{`)
+
+	f.Fuzz(func(t *testing.T, config string) {
+		stringConfig, err := json.Marshal(config)
+		require.NoError(t, err)
+
+		// invalid UTF-8 is replaced when marshalling, so the config is what the string form holds
+		require.NoError(t, json.Unmarshal(stringConfig, &config))
+
+		var fromString Config
+		stringErr := json.Unmarshal(stringConfig, &fromString)
+
+		// the embedded object form must decode like the string form
+		var fromObject Config
+		objectErr := json.Unmarshal([]byte(config), &fromObject)
+		if stringErr == nil && objectErr == nil {
+			assert.Equal(t, fromString, fromObject)
+		}
+
+		if stringErr != nil {
+			var configError *ConfigError
+			require.ErrorAs(t, stringErr, &configError)
+			assert.LessOrEqual(t, configError.Offset, int64(len(config)))
+			return
+		}
+
+		// a decoded config must never fail to be evaluated other than with an error
+		networkDefinition := NetworkAttachmentDefinition{Spec: Spec{Config: fromString}}
+		_, _ = networkDefinition.Networks()
+		_, _ = fromString.Subnets()
+		_ = fromString.Types()
+	})
+}
+
+func TestNetworks(t *testing.T) {
+	tests := []struct {
+		name          string
+		labels        map[string]string
+		config        string
+		networks      []Network
+		expectedError string
+	}{
+		{
+			name:     "single plugin",
+			config:   `{"cniVersion":"0.3.1","name":"network-1","type":"bridge","bridge":"mgmt-br","vlan":1337}`,
+			networks: []Network{{ClusterNetwork: "mgmt", VLAN: 1337}},
+		},
+		{
+			name:     "single plugin without a VLAN",
+			config:   `{"cniVersion":"0.3.1","name":"network-1","type":"bridge","bridge":"mgmt-br"}`,
+			networks: []Network{{ClusterNetwork: "mgmt", VLAN: 0}},
+		},
+		{
+			name: "conflist with the bridge plugin",
+			config: `{"cniVersion":"0.3.1","name":"network-1","plugins":[` +
+				`{"type":"bridge","bridge":"data-br","vlan":42},{"type":"tuning"}]}`,
+			networks: []Network{{ClusterNetwork: "data", VLAN: 42}},
+		},
+		{
+			name: "conflist with several VLANs",
+			config: `{"cniVersion":"0.3.1","name":"network-1","plugins":[` +
+				`{"type":"bridge","bridge":"mgmt-br","vlan":42},{"type":"bridge","bridge":"data-br","vlan":1337},` +
+				`{"type":"bridge","bridge":"mgmt-br","vlan":42}]}`,
+			networks: []Network{
+				{ClusterNetwork: "mgmt", VLAN: 42},
+				{ClusterNetwork: "data", VLAN: 1337},
+			},
+		},
+		{
+			name:     "conflist without a VLAN",
+			config:   `{"cniVersion":"0.3.1","name":"network-1","plugins":[{"type":"bridge","bridge":"mgmt-br"}]}`,
+			networks: []Network{{ClusterNetwork: "mgmt", VLAN: 0}},
+		},
+		{
+			name:     "cluster network label without a bridge",
+			labels:   map[string]string{"network.harvesterhci.io/clusternetwork": "data"},
+			config:   `{"cniVersion":"0.3.1","name":"network-1","type":"bridge","vlan":42}`,
+			networks: []Network{{ClusterNetwork: "data", VLAN: 42}},
+		},
+		{
+			name:     "bridge wins over the cluster network label",
+			labels:   map[string]string{"network.harvesterhci.io/clusternetwork": "data"},
+			config:   `{"cniVersion":"0.3.1","name":"network-1","type":"bridge","bridge":"mgmt-br","vlan":42}`,
+			networks: []Network{{ClusterNetwork: "mgmt", VLAN: 42}},
+		},
+		{
+			name: "VLAN trunk",
+			config: `{"cniVersion":"0.3.1","name":"network-1","type":"bridge","bridge":"data-br",` +
+				`"vlanTrunk":[{"id":42},{"minID":100,"maxID":102},{"id":101}]}`,
+			networks: []Network{
+				{ClusterNetwork: "data", VLAN: 42, Trunk: true},
+				{ClusterNetwork: "data", VLAN: 100, Trunk: true},
+				{ClusterNetwork: "data", VLAN: 101, Trunk: true},
+				{ClusterNetwork: "data", VLAN: 102, Trunk: true},
+			},
+		},
+		{
+			name: "VLAN and VLAN trunk in a conflist",
+			config: `{"cniVersion":"0.3.1","name":"network-1","plugins":[` +
+				`{"type":"bridge","bridge":"data-br","vlan":7,"vlanTrunk":[{"id":8}]}]}`,
+			networks: []Network{
+				{ClusterNetwork: "data", VLAN: 7},
+				{ClusterNetwork: "data", VLAN: 8, Trunk: true},
+			},
+		},
+		{
+			name:     "SR-IOV VLAN",
+			labels:   map[string]string{"network.harvesterhci.io/clusternetwork": "sriov"},
+			config:   `{"cniVersion":"0.3.1","name":"network-1","type":"sriov","vlan":300,"spoofchk":"on"}`,
+			networks: []Network{{ClusterNetwork: "sriov", VLAN: 300}},
+		},
+		{
+			name:     "macvlan master VLAN interface",
+			labels:   map[string]string{"network.harvesterhci.io/clusternetwork": "data"},
+			config:   `{"cniVersion":"0.3.1","name":"network-1","type":"macvlan","master":"eth0.300"}`,
+			networks: []Network{{ClusterNetwork: "data", VLAN: 300}},
+		},
+		{
+			name:     "ipvlan master on a Harvester bridge",
+			config:   `{"cniVersion":"0.3.1","name":"network-1","type":"ipvlan","master":"data-br.300"}`,
+			networks: []Network{{ClusterNetwork: "data", VLAN: 300}},
+		},
+		{
+			name:     "macvlan master without a VLAN",
+			labels:   map[string]string{"network.harvesterhci.io/clusternetwork": "data"},
+			config:   `{"cniVersion":"0.3.1","name":"network-1","type":"macvlan","master":"eth0"}`,
+			networks: []Network{{ClusterNetwork: "data", VLAN: 0}},
+		},
+		{
+			name:     "kube-ovn provider",
+			config:   `{"cniVersion":"0.3.1","name":"network-1","type":"kube-ovn","provider":"vlan-subnet.default.ovn"}`,
+			networks: []Network{{ClusterNetwork: "vlan-subnet.default.ovn", VLAN: 0}},
+		},
+		{
+			name: "conflist with a meta plugin",
+			config: `{"cniVersion":"0.3.1","name":"network-1","plugins":[` +
+				`{"type":"macvlan","master":"eth0.42"},{"type":"tuning","vlan":1337}]}`,
+			networks: []Network{
+				{ClusterNetwork: "", VLAN: 42},
+				{ClusterNetwork: "", VLAN: 1337},
+			},
+		},
+		{
+			name:          "macvlan master with a bad VLAN",
+			config:        `{"cniVersion":"0.3.1","name":"network-1","type":"macvlan","master":"eth0.abc"}`,
+			expectedError: "invalid 'macvlan' plugin: master 'eth0.abc' is not a VLAN interface",
+		},
+		{
+			name:          "ipvlan master with a VLAN out of range",
+			config:        `{"cniVersion":"0.3.1","name":"network-1","type":"ipvlan","master":"eth0.4095"}`,
+			expectedError: "invalid 'ipvlan' plugin: master 'eth0.4095' has a VLAN out of range 1-4094",
+		},
+		{
+			name:          "VLAN out of range",
+			config:        `{"cniVersion":"0.3.1","name":"network-1","type":"bridge","bridge":"mgmt-br","vlan":4095}`,
+			expectedError: "invalid 'bridge' plugin: vlan 4095 is out of range 1-4094",
+		},
+		{
+			name:          "negative VLAN",
+			config:        `{"cniVersion":"0.3.1","name":"network-1","type":"bridge","bridge":"mgmt-br","vlan":-1}`,
+			expectedError: "invalid 'bridge' plugin: vlan -1 is out of range 1-4094",
+		},
+		{
+			name:          "SR-IOV VLAN out of range",
+			config:        `{"cniVersion":"0.3.1","name":"network-1","type":"sriov","vlan":5000}`,
+			expectedError: "invalid 'sriov' plugin: vlan 5000 is out of range 1-4094",
+		},
+		{
+			name:          "VLAN trunk entry without an id",
+			config:        `{"cniVersion":"0.3.1","name":"network-1","type":"bridge","vlanTrunk":[{"minID":100}]}`,
+			expectedError: "invalid 'bridge' plugin: a vlanTrunk entry needs either an id, or a minID and a maxID",
+		},
+		{
+			name: "VLAN trunk entry with an id and a range",
+			config: `{"cniVersion":"0.3.1","name":"network-1","type":"bridge",` +
+				`"vlanTrunk":[{"id":1,"minID":1,"maxID":2}]}`,
+			expectedError: "invalid 'bridge' plugin: a vlanTrunk entry needs either an id, or a minID and a maxID",
+		},
+		{
+			name: "VLAN trunk entry out of range",
+			config: `{"cniVersion":"0.3.1","name":"network-1","type":"bridge",` +
+				`"vlanTrunk":[{"minID":4000,"maxID":4095}]}`,
+			expectedError: "invalid 'bridge' plugin: invalid vlanTrunk entry: VLANs 4000-4095 are out of range 1-4094",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := json.Marshal(map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "network-1", "namespace": "namespace-1", "labels": tt.labels},
+				"spec":     map[string]string{"config": tt.config},
+			})
+			require.NoError(t, err)
+
+			var networkDefinition NetworkAttachmentDefinition
+			err = json.Unmarshal(payload, &networkDefinition)
+			require.NoError(t, err)
+
+			networks, err := networkDefinition.Networks()
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.networks, networks)
+		})
+	}
+}
+
+func TestConfigTypes(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		types  []string
+	}{
+		{
+			name:   "single plugin",
+			config: Config{Plugin: Plugin{Type: "bridge"}},
+			types:  []string{"bridge"},
+		},
+		{
+			name:   "conflist",
+			config: Config{Plugins: []Plugin{{Type: "macvlan"}, {Type: "tuning"}, {Type: "macvlan"}}},
+			types:  []string{"macvlan", "tuning"},
+		},
+		{
+			name:   "untyped plugin",
+			config: Config{},
+			types:  []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.types, tt.config.Types())
+		})
+	}
+}
+
+func TestConfigSubnets(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        string
+		subnets       []string
+		expectedError string
+	}{
+		{
+			name:    "whereabouts range",
+			config:  `{"type":"bridge","ipam":{"type":"whereabouts","range":"192.168.2.225/28"}}`,
+			subnets: []string{"192.168.2.224/28"},
+		},
+		{
+			name:    "whereabouts range with start and end",
+			config:  `{"type":"bridge","ipam":{"type":"whereabouts","range":"192.168.2.225-192.168.2.230/28"}}`,
+			subnets: []string{"192.168.2.224/28"},
+		},
+		{
+			name: "whereabouts ipRanges",
+			config: `{"type":"bridge","ipam":{"type":"whereabouts","ipRanges":[` +
+				`{"range":"10.2.0.0/24"},{"range":"10.3.0.10-10.3.0.20/24"},{"range":"fd00:10::/64"}]}}`,
+			subnets: []string{"10.2.0.0/24", "10.3.0.0/24", "fd00:10::/64"},
+		},
+		{
+			name: "host-local subnet and ranges",
+			config: `{"type":"bridge","ipam":{"type":"host-local","subnet":"10.1.0.0/16","ranges":[` +
+				`[{"subnet":"10.2.0.0/24"},{"subnet":"10.3.0.0/24"}],[{"subnet":"fd00:10::/64"}]]}}`,
+			subnets: []string{"10.1.0.0/16", "10.2.0.0/24", "10.3.0.0/24", "fd00:10::/64"},
+		},
+		{
+			name: "static addresses in a conflist",
+			config: `{"plugins":[{"type":"bridge","ipam":{"type":"static","addresses":[` +
+				`{"address":"10.10.0.1/24"},{"address":"fd00:10::1/64"}]}},{"type":"tuning"}]}`,
+			subnets: []string{"10.10.0.0/24", "fd00:10::/64"},
+		},
+		{
+			name:    "dhcp",
+			config:  `{"type":"bridge","ipam":{"type":"dhcp"}}`,
+			subnets: []string{},
+		},
+		{
+			name:    "no IPAM",
+			config:  `{"type":"bridge","ipam":{}}`,
+			subnets: []string{},
+		},
+		{
+			name:          "bad subnet",
+			config:        `{"type":"bridge","ipam":{"type":"whereabouts","range":"192.168.2.0"}}`,
+			expectedError: "invalid 'whereabouts' IPAM subnet '192.168.2.0'",
+		},
+		{
+			name:          "range start outside of the subnet",
+			config:        `{"type":"bridge","ipam":{"type":"whereabouts","range":"192.168.3.1-192.168.2.230/28"}}`,
+			expectedError: "invalid 'whereabouts' IPAM subnet '192.168.3.1-192.168.2.230/28'",
+		},
+		{
+			name:          "bad ipRanges range",
+			config:        `{"type":"bridge","ipam":{"type":"whereabouts","ipRanges":[{"range":"10.2.0.0-/24"}]}}`,
+			expectedError: "invalid 'whereabouts' IPAM subnet '10.2.0.0-/24'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the config is a JSON string in a NetworkAttachmentDefinition
+			var config Config
+			payload, err := json.Marshal(tt.config)
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(payload, &config))
+
+			subnets, err := config.Subnets()
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+
+			expected := []netip.Prefix{}
+			for _, subnet := range tt.subnets {
+				expected = append(expected, netip.MustParsePrefix(subnet))
+			}
+			assert.Equal(t, expected, subnets)
+		})
+	}
+}
+
+// sharedNetworkCase is a case of the NetworkAttachmentDefinitions that harvester-restricted-network-vm reads
+// the same networks from.
+type sharedNetworkCase struct {
+	Name     string            `json:"name"`
+	Labels   map[string]string `json:"labels"`
+	Config   string            `json:"config"`
+	Networks []struct {
+		ClusterNetwork string `json:"clusterNetwork"`
+		VLAN           int    `json:"vlan"`
+	} `json:"networks"`
+	Invalid bool `json:"invalid"`
+}
+
+// item returns the NetworkAttachmentDefinition of the case.
+func (c *sharedNetworkCase) item(t *testing.T) json.RawMessage {
+	t.Helper()
+
+	item, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "network-1", "namespace": "namespace-1", "labels": c.Labels},
+		"spec":     map[string]string{"config": c.Config},
+	})
+	require.NoError(t, err)
+
+	return item
+}
+
+func TestSharedNetworks(t *testing.T) {
+	data, err := os.ReadFile("../../harvester-restricted-network-vm/test_data/network_attachment_definitions.json")
+	require.NoError(t, err)
+
+	cases := []sharedNetworkCase{}
+	require.NoError(t, json.Unmarshal(data, &cases))
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			networkDefinition := NetworkAttachmentDefinition{}
+			require.NoError(t, json.Unmarshal(tc.item(t), &networkDefinition))
+
+			networks, err := networkDefinition.Networks()
+			if tc.Invalid {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			expected := []Network{}
+			for _, network := range tc.Networks {
+				expected = append(expected, Network{ClusterNetwork: network.ClusterNetwork, VLAN: network.VLAN})
+			}
+			// the VM policy doesn't tell the VLANs of a trunk apart
+			for i := range networks {
+				networks[i].Trunk = false
+			}
+			assert.Equal(t, expected, networks)
+		})
+	}
 }
@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// routeAnnotation is the annotation Harvester reads the DHCP server and the route of a VM network from.
+const routeAnnotation = "network.harvesterhci.io/route"
+
+// networkTypeLabel is the label Harvester sets to the kind of a VM network.
+const networkTypeLabel = "network.harvesterhci.io/type"
+
+// RouteMode is how Harvester finds the route of a VM network.
+type RouteMode string
+
+const (
+	// RouteModeAuto discovers the CIDR and the gateway with DHCP, they're filled in once discovered.
+	RouteModeAuto RouteMode = "auto"
+	// RouteModeManual takes the CIDR and the gateway from the annotation.
+	RouteModeManual RouteMode = "manual"
+)
+
+// NetworkType is the kind of a Harvester VM network.
+type NetworkType string
+
+const (
+	NetworkTypeUntagged  NetworkType = "UntaggedNetwork"
+	NetworkTypeVLAN      NetworkType = "L2VlanNetwork"
+	NetworkTypeVLANTrunk NetworkType = "L2VlanTrunkNetwork"
+)
+
+// Route is the route annotation of a Harvester VM network.
+type Route struct {
+	Mode    RouteMode `json:"mode"`
+	CIDR    string    `json:"cidr"`
+	Gateway string    `json:"gateway"`
+}
+
+// Route returns the route annotation, and whether there is one.
+func (n *NetworkAttachmentDefinition) Route() (Route, bool, error) {
+	value, ok := n.Metadata.Annotations[routeAnnotation]
+	if !ok {
+		return Route{}, false, nil
+	}
+
+	route := Route{}
+	err := json.Unmarshal([]byte(value), &route)
+	if err != nil {
+		return Route{}, false, fmt.Errorf("annotation '%s' is not a valid route: %w", routeAnnotation, err)
+	}
+
+	switch route.Mode {
+	case "":
+		// Harvester defaults to auto
+		route.Mode = RouteModeAuto
+	case RouteModeAuto, RouteModeManual:
+	default:
+		return Route{}, false, fmt.Errorf("annotation '%s' has an unknown mode '%s'", routeAnnotation, route.Mode)
+	}
+
+	return route, true, nil
+}
+
+// Subnets returns the CIDR of the route, and its gateway as a single address subnet.
+// Either can be empty, e.g. before the auto mode has discovered them.
+func (r *Route) Subnets() ([]netip.Prefix, error) {
+	subnets := []netip.Prefix{}
+
+	var cidr netip.Prefix
+	if r.CIDR != "" {
+		var err error
+		cidr, err = netip.ParsePrefix(r.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route CIDR '%s'", r.CIDR)
+		}
+		cidr = cidr.Masked()
+		subnets = append(subnets, cidr)
+	}
+
+	if r.Gateway != "" {
+		gateway, err := netip.ParseAddr(r.Gateway)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route gateway '%s'", r.Gateway)
+		}
+		if cidr.IsValid() && !cidr.Contains(gateway) {
+			return nil, fmt.Errorf("route gateway %s is outside of the route CIDR %s", gateway, cidr)
+		}
+		subnets = append(subnets, netip.PrefixFrom(gateway, gateway.BitLen()))
+	}
+
+	return subnets, nil
+}
+
+// ValidateNetworkType ensures that the network type label, when there is one, is the kind of the networks:
+// an untagged network has no VLAN, a VLAN network has VLANs but no trunk, and a VLAN trunk network has a trunk.
+func (n *NetworkAttachmentDefinition) ValidateNetworkType(networks []Network) error {
+	value, ok := n.Metadata.Labels[networkTypeLabel]
+	if !ok {
+		return nil
+	}
+
+	isUntagged := func(network Network) bool { return network.VLAN == untaggedVLAN }
+	isTrunk := func(network Network) bool { return network.Trunk }
+
+	var matches bool
+	switch networkType := NetworkType(value); networkType {
+	case NetworkTypeUntagged:
+		matches = !slices.ContainsFunc(networks, func(network Network) bool { return !isUntagged(network) })
+	case NetworkTypeVLAN:
+		matches = !slices.ContainsFunc(networks, isUntagged) && !slices.ContainsFunc(networks, isTrunk)
+	case NetworkTypeVLANTrunk:
+		matches = slices.ContainsFunc(networks, isTrunk)
+	default:
+		return fmt.Errorf("label '%s' has an unknown network type '%s'", networkTypeLabel, value)
+	}
+
+	if !matches {
+		return fmt.Errorf("network type '%s' does not match the VLANs of %s", value, configPath)
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoute(t *testing.T) {
+	tests := []struct {
+		name          string
+		annotations   map[string]string
+		route         Route
+		found         bool
+		expectedError string
+	}{
+		{
+			name: "no route",
+		},
+		{
+			name: "manual route",
+			annotations: map[string]string{
+				"network.harvesterhci.io/route": `{"mode":"manual","serverIPAddr":"","cidr":"10.0.0.0/24",` +
+					`"gateway":"10.0.0.1"}`,
+			},
+			route: Route{Mode: RouteModeManual, CIDR: "10.0.0.0/24", Gateway: "10.0.0.1"},
+			found: true,
+		},
+		{
+			name:        "auto route",
+			annotations: map[string]string{"network.harvesterhci.io/route": `{"mode":"auto"}`},
+			route:       Route{Mode: RouteModeAuto},
+			found:       true,
+		},
+		{
+			name:        "route without a mode",
+			annotations: map[string]string{"network.harvesterhci.io/route": `{"cidr":"10.0.0.0/24"}`},
+			route:       Route{Mode: RouteModeAuto, CIDR: "10.0.0.0/24"},
+			found:       true,
+		},
+		{
+			name:          "invalid route",
+			annotations:   map[string]string{"network.harvesterhci.io/route": `{"mode":`},
+			expectedError: "annotation 'network.harvesterhci.io/route' is not a valid route: unexpected end of JSON input",
+		},
+		{
+			name:          "unknown mode",
+			annotations:   map[string]string{"network.harvesterhci.io/route": `{"mode":"static"}`},
+			expectedError: "annotation 'network.harvesterhci.io/route' has an unknown mode 'static'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networkDefinition := NetworkAttachmentDefinition{Metadata: Metadata{Annotations: tt.annotations}}
+
+			route, found, err := networkDefinition.Route()
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.route, route)
+		})
+	}
+}
+
+func TestRouteSubnets(t *testing.T) {
+	tests := []struct {
+		name          string
+		route         Route
+		subnets       []netip.Prefix
+		expectedError string
+	}{
+		{
+			name:    "auto route not discovered yet",
+			route:   Route{Mode: RouteModeAuto},
+			subnets: []netip.Prefix{},
+		},
+		{
+			name:  "CIDR and gateway",
+			route: Route{Mode: RouteModeManual, CIDR: "10.0.0.7/24", Gateway: "10.0.0.1"},
+			subnets: []netip.Prefix{
+				netip.MustParsePrefix("10.0.0.0/24"),
+				netip.MustParsePrefix("10.0.0.1/32"),
+			},
+		},
+		{
+			name:    "IPv6 gateway",
+			route:   Route{Mode: RouteModeManual, Gateway: "fd00:10::1"},
+			subnets: []netip.Prefix{netip.MustParsePrefix("fd00:10::1/128")},
+		},
+		{
+			name:          "invalid CIDR",
+			route:         Route{Mode: RouteModeManual, CIDR: "10.0.0.0"},
+			expectedError: "invalid route CIDR '10.0.0.0'",
+		},
+		{
+			name:          "invalid gateway",
+			route:         Route{Mode: RouteModeManual, Gateway: "10.0.0.0/24"},
+			expectedError: "invalid route gateway '10.0.0.0/24'",
+		},
+		{
+			name:          "gateway outside of the CIDR",
+			route:         Route{Mode: RouteModeManual, CIDR: "10.0.0.0/24", Gateway: "10.0.1.1"},
+			expectedError: "route gateway 10.0.1.1 is outside of the route CIDR 10.0.0.0/24",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subnets, err := tt.route.Subnets()
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.subnets, subnets)
+		})
+	}
+}
+
+func TestValidateNetworkType(t *testing.T) {
+	untagged := []Network{{ClusterNetwork: "mgmt"}}
+	vlan := []Network{{ClusterNetwork: "mgmt", VLAN: 42}}
+	trunk := []Network{{ClusterNetwork: "mgmt", VLAN: 42, Trunk: true}}
+
+	tests := []struct {
+		name          string
+		networkType   string
+		networks      []Network
+		expectedError string
+	}{
+		{name: "no network type", networks: vlan},
+		{name: "untagged network", networkType: "UntaggedNetwork", networks: untagged},
+		{name: "VLAN network", networkType: "L2VlanNetwork", networks: vlan},
+		{name: "VLAN trunk network", networkType: "L2VlanTrunkNetwork", networks: trunk},
+		{
+			name:          "untagged network with a VLAN",
+			networkType:   "UntaggedNetwork",
+			networks:      vlan,
+			expectedError: "network type 'UntaggedNetwork' does not match the VLANs of spec.config",
+		},
+		{
+			name:          "VLAN network without a VLAN",
+			networkType:   "L2VlanNetwork",
+			networks:      untagged,
+			expectedError: "network type 'L2VlanNetwork' does not match the VLANs of spec.config",
+		},
+		{
+			name:          "VLAN network with a trunk",
+			networkType:   "L2VlanNetwork",
+			networks:      trunk,
+			expectedError: "network type 'L2VlanNetwork' does not match the VLANs of spec.config",
+		},
+		{
+			name:          "VLAN trunk network without a trunk",
+			networkType:   "L2VlanTrunkNetwork",
+			networks:      vlan,
+			expectedError: "network type 'L2VlanTrunkNetwork' does not match the VLANs of spec.config",
+		},
+		{
+			name:          "unknown network type",
+			networkType:   "OverlayNetwork",
+			networks:      vlan,
+			expectedError: "label 'network.harvesterhci.io/type' has an unknown network type 'OverlayNetwork'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networkDefinition := NetworkAttachmentDefinition{}
+			if tt.networkType != "" {
+				networkDefinition.Metadata.Labels = map[string]string{"network.harvesterhci.io/type": tt.networkType}
+			}
+
+			err := networkDefinition.ValidateNetworkType(tt.networks)
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
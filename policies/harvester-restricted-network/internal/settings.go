@@ -3,6 +3,9 @@ package internal
 import (
 	"context"
 	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
 
 	"github.com/SUSE/openplatform-kubewarden-policies/policies/harvester-restricted-network/internal/logger"
 	"github.com/francoispqt/onelog"
@@ -10,84 +13,502 @@ import (
 
 type NamespaceVLANBinding struct {
 	Namespace string `json:"namespace"`
-	VLAN      int    `json:"vlan"`
+	VLAN      int    `json:"vlan,omitempty"`
+	// VLANs are VLANs, e.g. "310", or VLAN ranges, e.g. "200-299".
+	VLANs []string `json:"vlans,omitempty"`
+	// Untagged binds the untagged network, a NetworkAttachmentDefinition without a VLAN.
+	Untagged bool `json:"untagged,omitempty"`
+	// ClusterNetwork restricts the binding to a Harvester cluster network, e.g. "mgmt", an empty one allows any.
+	ClusterNetwork string `json:"clusterNetwork,omitempty"`
+}
+
+func (b *NamespaceVLANBinding) owner() vlanOwner {
+	return vlanOwner{namespace: b.Namespace, clusterNetwork: b.ClusterNetwork}
+}
+
+// NamespaceCNITypes restricts the CNI plugin types that a namespace can use.
+type NamespaceCNITypes struct {
+	Namespace string   `json:"namespace"`
+	Types     []string `json:"types"`
+}
+
+// NamespaceSubnetBinding grants IPAM subnets to a namespace.
+type NamespaceSubnetBinding struct {
+	Namespace string `json:"namespace"`
+	// Subnets are IPv4 or IPv6 CIDRs, e.g. "10.10.0.0/16" or "fd00:10::/64".
+	Subnets []string `json:"subnets"`
+}
+
+// ReservedVLANs are VLANs that only system namespaces can use, e.g. the storage network of harvester-system.
+type ReservedVLANs struct {
+	// VLANs are VLANs, e.g. "310", or VLAN ranges, e.g. "200-299".
+	VLANs []string `json:"vlans,omitempty"`
+	// Untagged reserves the untagged network, "0" isn't a VLAN ID, like in the bindings.
+	Untagged   bool     `json:"untagged,omitempty"`
+	Namespaces []string `json:"namespaces"`
+}
+
+// ranges returns the valid reserved VLAN ranges, the untagged network is the range 0-0.
+// Invalid VLANs are reported by reservedProblems.
+func (r *ReservedVLANs) ranges() []VLANRange {
+	ranges := []VLANRange{}
+	for _, value := range r.VLANs {
+		if vlanRange, err := ParseVLANRange(value); err == nil {
+			ranges = append(ranges, vlanRange)
+		}
+	}
+
+	if r.Untagged {
+		ranges = append(ranges, VLANRange{Start: untaggedVLAN, End: untaggedVLAN})
+	}
+
+	return ranges
 }
 
 // Settings is the structure that describes the policy settings.
 type Settings struct {
 	NamespaceVLANBindings []NamespaceVLANBinding `json:"namespaceVLANBindings"`
+	// VLANTrunkDeniedNamespaces can't create networks with a VLAN trunk, whatever their bindings.
+	VLANTrunkDeniedNamespaces []string `json:"vlanTrunkDeniedNamespaces,omitempty"`
+	// NamespaceCNITypes limits the CNI types of the listed namespaces, the others can use any type.
+	NamespaceCNITypes []NamespaceCNITypes `json:"namespaceCNITypes,omitempty"`
+	// NamespaceSubnetBindings limits the IPAM subnets of the listed namespaces, the others can use any subnet.
+	NamespaceSubnetBindings []NamespaceSubnetBinding `json:"namespaceSubnetBindings,omitempty"`
+	// ReservedVLANs take precedence over the bindings.
+	ReservedVLANs []ReservedVLANs `json:"reservedVLANs,omitempty"`
+	// UniqueVLANs rejects a network that a NetworkAttachmentDefinition of another namespace already uses,
+	// unless both namespaces are bound to it. It lists the NetworkAttachmentDefinitions of the cluster.
+	UniqueVLANs bool `json:"uniqueVLANs,omitempty"`
+	// ProtectNetworksInUse rejects the deletion of a NetworkAttachmentDefinition that VirtualMachines still use.
+	// It lists the VirtualMachines of the cluster.
+	ProtectNetworksInUse bool `json:"protectNetworksInUse,omitempty"`
+	// StrictConfigName rejects a spec.config whose name isn't the name of the NetworkAttachmentDefinition.
+	StrictConfigName bool `json:"strictConfigName,omitempty"`
+
+	// vlans is built from the bindings on the first lookup
+	vlans *vlanIndex
 }
 
-// IsValid verifies the Settings object, by ensuring that the namespace and VLANs are always defined.
-func (s *Settings) IsValid(ctx context.Context) bool {
-	l := logger.FromContext(ctx)
+// SettingsError lists every problem found in the settings.
+type SettingsError struct {
+	Problems []string
+}
+
+func (e *SettingsError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// NewSettingsFromJSON decodes the settings with decodeStrict.
+func NewSettingsFromJSON(payload []byte) (Settings, error) {
+	settings := Settings{}
+	err := decodeStrict(payload, &settings)
+	return settings, err
+}
 
-	for _, ns := range s.NamespaceVLANBindings {
+// Validate verifies the Settings object, and returns a SettingsError with every problem it found.
+func (s *Settings) Validate() error {
+	problems := s.bindingProblems()
+	problems = append(problems, s.reservedProblems()...)
+	problems = append(problems, s.trunkProblems()...)
+	problems = append(problems, s.cniTypeProblems()...)
+	problems = append(problems, s.subnetProblems()...)
+
+	if len(problems) > 0 {
+		return &SettingsError{Problems: problems}
+	}
+
+	return nil
+}
+
+// bindingProblems ensures that every binding is complete, and doesn't bind reserved VLANs to other namespaces.
+//
+// Ranges of a namespace on a cluster network must not overlap, but ranges of different namespaces can, to share VLANs.
+func (s *Settings) bindingProblems() []string {
+	problems := []string{}
+	seen := map[vlanOwner][]indexedVLANRange{}
+
+	for i, ns := range s.NamespaceVLANBindings {
 		// Check if namespace and network are not empty
-		if ns.Namespace == "" || ns.VLAN == 0 {
-			l.DebugWithFields("Namespace or VLAN required", func(e onelog.Entry) {
-				e.String("Namespace", ns.Namespace)
-				e.Int("VLAN", ns.VLAN)
-			})
-			return false
+		if ns.Namespace == "" || (ns.VLAN == 0 && len(ns.VLANs) == 0 && !ns.Untagged) {
+			problems = append(problems,
+				fmt.Sprintf("namespaceVLANBindings[%d]: namespace and vlan, vlans or untagged must be specified", i))
+			continue
+		}
+
+		ranges, rangeProblems := bindingRanges(i, &ns)
+		problems = append(problems, rangeProblems...)
+
+		for _, r := range ranges {
+			if problem, ok := s.reservedOverlapProblem(i, ns.Namespace, r); ok {
+				problems = append(problems, problem)
+				continue
+			}
+
+			if problem, ok := overlapProblem(i, r, seen[ns.owner()]); ok {
+				problems = append(problems, problem)
+				continue
+			}
+			seen[ns.owner()] = append(seen[ns.owner()], indexedVLANRange{index: i, vlanRange: r})
 		}
 	}
-	return true
+
+	return problems
+}
+
+// reservedProblems ensures that every reserved VLAN is valid and has system namespaces.
+func (s *Settings) reservedProblems() []string {
+	problems := []string{}
+
+	for i, reserved := range s.ReservedVLANs {
+		if (len(reserved.VLANs) == 0 && !reserved.Untagged) ||
+			len(reserved.Namespaces) == 0 || slices.Contains(reserved.Namespaces, "") {
+			problems = append(problems,
+				fmt.Sprintf("reservedVLANs[%d]: vlans or untagged, and namespaces must be specified", i))
+			continue
+		}
+
+		for j, value := range reserved.VLANs {
+			if _, err := ParseVLANRange(value); err != nil {
+				problems = append(problems, fmt.Sprintf("reservedVLANs[%d].vlans[%d]: %v", i, j, err))
+			}
+		}
+	}
+
+	return problems
+}
+
+// reservedOverlapProblem checks that a VLAN range bound to a namespace isn't reserved for other namespaces.
+func (s *Settings) reservedOverlapProblem(i int, namespace string, r VLANRange) (string, bool) {
+	for j, reserved := range s.ReservedVLANs {
+		if slices.Contains(reserved.Namespaces, namespace) {
+			continue
+		}
+
+		for _, reservedRange := range reserved.ranges() {
+			if r.overlaps(reservedRange) {
+				return fmt.Sprintf("namespaceVLANBindings[%d]: VLANs %s overlap reserved VLANs %s of reservedVLANs[%d]",
+					i, r.name(), reservedRange.name(), j), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// reservedFor returns the system namespaces that a VLAN is reserved for.
+func (s *Settings) reservedFor(vlan int) ([]string, bool) {
+	for _, reserved := range s.ReservedVLANs {
+		for _, reservedRange := range reserved.ranges() {
+			if reservedRange.overlaps(VLANRange{Start: vlan, End: vlan}) {
+				return reserved.Namespaces, true
+			}
+		}
+	}
+
+	return nil, false
 }
 
-// IsVLANAllowed verifies if a (namespace, VLAN) combination is allowed.
+// trunkProblems ensures that every namespace denied VLAN trunks is specified once.
+func (s *Settings) trunkProblems() []string {
+	problems := []string{}
+	seen := map[string]int{}
+
+	for i, namespace := range s.VLANTrunkDeniedNamespaces {
+		if namespace == "" {
+			problems = append(problems, fmt.Sprintf("vlanTrunkDeniedNamespaces[%d]: namespace must be specified", i))
+			continue
+		}
+
+		if first, ok := seen[namespace]; ok {
+			problems = append(problems,
+				fmt.Sprintf("vlanTrunkDeniedNamespaces[%d]: duplicate of vlanTrunkDeniedNamespaces[%d]", i, first))
+			continue
+		}
+		seen[namespace] = i
+	}
+
+	return problems
+}
+
+// cniTypeProblems ensures that every namespace lists its CNI types once.
+func (s *Settings) cniTypeProblems() []string {
+	problems := []string{}
+	seen := map[string]int{}
+
+	for i, cniTypes := range s.NamespaceCNITypes {
+		if cniTypes.Namespace == "" || len(cniTypes.Types) == 0 || slices.Contains(cniTypes.Types, "") {
+			problems = append(problems, fmt.Sprintf("namespaceCNITypes[%d]: namespace and types must be specified", i))
+			continue
+		}
+
+		if first, ok := seen[cniTypes.Namespace]; ok {
+			problems = append(problems,
+				fmt.Sprintf("namespaceCNITypes[%d]: duplicate of namespaceCNITypes[%d]", i, first))
+			continue
+		}
+		seen[cniTypes.Namespace] = i
+	}
+
+	return problems
+}
+
+// subnetProblems ensures that every namespace lists valid subnets once.
+func (s *Settings) subnetProblems() []string {
+	problems := []string{}
+	seen := map[string]int{}
+
+	for i, binding := range s.NamespaceSubnetBindings {
+		if binding.Namespace == "" || len(binding.Subnets) == 0 {
+			problems = append(problems,
+				fmt.Sprintf("namespaceSubnetBindings[%d]: namespace and subnets must be specified", i))
+			continue
+		}
+
+		for j, subnet := range binding.Subnets {
+			if _, err := netip.ParsePrefix(subnet); err != nil {
+				problems = append(problems,
+					fmt.Sprintf("namespaceSubnetBindings[%d].subnets[%d]: invalid CIDR '%s'", i, j, subnet))
+			}
+		}
+
+		if first, ok := seen[binding.Namespace]; ok {
+			problems = append(problems,
+				fmt.Sprintf("namespaceSubnetBindings[%d]: duplicate of namespaceSubnetBindings[%d]", i, first))
+			continue
+		}
+		seen[binding.Namespace] = i
+	}
+
+	return problems
+}
+
+type indexedVLANRange struct {
+	index     int
+	vlanRange VLANRange
+}
+
+// bindingRanges returns the valid ranges of a binding, and a problem for each invalid one.
+func bindingRanges(i int, ns *NamespaceVLANBinding) ([]VLANRange, []string) {
+	ranges := []VLANRange{}
+	problems := []string{}
+
+	if ns.Untagged {
+		ranges = append(ranges, VLANRange{Start: untaggedVLAN, End: untaggedVLAN})
+	}
+
+	if ns.VLAN != 0 {
+		vlanRange := VLANRange{Start: ns.VLAN, End: ns.VLAN}
+		if err := vlanRange.validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("namespaceVLANBindings[%d].vlan: %v", i, err))
+		} else {
+			ranges = append(ranges, vlanRange)
+		}
+	}
+
+	for j, value := range ns.VLANs {
+		vlanRange, err := ParseVLANRange(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("namespaceVLANBindings[%d].vlans[%d]: %v", i, j, err))
+			continue
+		}
+		ranges = append(ranges, vlanRange)
+	}
+
+	return ranges, problems
+}
+
+// overlapProblem checks a range against the ranges already bound to the same namespace and cluster network.
+func overlapProblem(i int, r VLANRange, seen []indexedVLANRange) (string, bool) {
+	for _, other := range seen {
+		switch {
+		case !r.overlaps(other.vlanRange):
+			continue
+		case other.index == i:
+			return fmt.Sprintf("namespaceVLANBindings[%d]: VLANs %s overlap VLANs %s",
+				i, r, other.vlanRange), true
+		case r == other.vlanRange:
+			return fmt.Sprintf("namespaceVLANBindings[%d]: duplicate of namespaceVLANBindings[%d]",
+				i, other.index), true
+		default:
+			return fmt.Sprintf("namespaceVLANBindings[%d]: VLANs %s overlap VLANs %s of namespaceVLANBindings[%d]",
+				i, r, other.vlanRange, other.index), true
+		}
+	}
+
+	return "", false
+}
+
+// IsVLANAllowed verifies if a (namespace, cluster network, VLAN) combination is allowed.
 //
 // Restrictions
-//   - namespaces with vlan bindings can only accept a vlan bound to it
-//   - VLANs with namespace bindings can only accept a namespace bound to it
+//   - namespaces with vlan bindings can only accept a vlan bound to it, on the bound cluster network
+//   - VLANs with namespace bindings can only accept a namespace bound to it, on the bound cluster network
+//   - a binding without a cluster network binds the VLAN on every cluster network
 //   - If a namespace and VLAN don't have a binding, then it's unrestricted
 //
 // example:
 //
 //	  settings:
 //			- namespace: restricted-namespace
-//			  network: 42
+//			  vlans: ["42", "200-299"]
+//			  clusterNetwork: data
 //
 // Allowed:
 //
-//	{"namespace": "restricted-namespace", "vlan": "42"}
-//	{"namespace": "random-namespace", "network": "1337"}
+//	{"namespace": "restricted-namespace", "clusterNetwork": "data", "vlan": "42"}
+//	{"namespace": "restricted-namespace", "clusterNetwork": "data", "vlan": "250"}
+//	{"namespace": "random-namespace", "clusterNetwork": "data", "network": "1337"}
+//	{"namespace": "random-namespace", "clusterNetwork": "mgmt", "network": "42"}
 //
 // Denied:
 //
-//	{"namespace": "restricted-namespace", "network": "1337"}
-//	{"namespace": "random-namespace", "network": "42"}
-func (s *Settings) IsVLANAllowed(ctx context.Context, namespace string, vlan int) bool {
-	allowed := true
+//	{"namespace": "restricted-namespace", "clusterNetwork": "data", "network": "1337"}
+//	{"namespace": "restricted-namespace", "clusterNetwork": "mgmt", "network": "42"}
+//	{"namespace": "random-namespace", "clusterNetwork": "data", "network": "42"}
+//	{"namespace": "random-namespace", "clusterNetwork": "data", "network": "250"}
+//
+// The decision tells which bindings led to it, a denied VLAN prefers the namespaces it's reserved for.
+func (s *Settings) IsVLANAllowed(ctx context.Context, namespace, clusterNetwork string, vlan int) VLANDecision {
 	l := logger.FromContext(ctx).With(func(e onelog.Entry) {
 		e.String("Namespace", namespace)
+		e.String("ClusterNetwork", clusterNetwork)
 		e.Int("VLAN", vlan)
 	})
 
-	for _, ns := range s.NamespaceVLANBindings {
-		// if a namespace is bound, then its vlan must be bound to it
-		if ns.Namespace == namespace && ns.VLAN != vlan {
-			allowed = false
-		}
+	decision := VLANDecision{
+		Namespace:      namespace,
+		ClusterNetwork: clusterNetwork,
+		VLAN:           vlan,
+		Owners:         []string{},
+		NamespaceVLANs: []string{},
+	}
 
-		// if a vlan is bound, then its namespace must be bound to it
-		if ns.VLAN == vlan && ns.Namespace != namespace {
-			allowed = false
+	// reserved vlans take precedence over the bindings
+	if systemNamespaces, ok := s.reservedFor(vlan); ok {
+		decision.Allowed = slices.Contains(systemNamespaces, namespace)
+		decision.Reason = VLANReasonSystemReserved
+		decision.Owners = systemNamespaces
+		l.Debug(decision.String())
+		return decision
+	}
+
+	for _, owner := range s.index().lookup(vlan) {
+		if owner.clusterNetwork != "" && owner.clusterNetwork != clusterNetwork {
+			continue
 		}
 
 		// vlan and namespace are bound
-		if ns.VLAN == vlan && ns.Namespace == namespace {
+		if owner.namespace == namespace {
 			l.Debug("vlan and namespace matched")
-			return true
+			decision.Allowed = true
+			decision.Reason = VLANReasonBound
+			decision.Owners = []string{namespace}
+			return decision
+		}
+
+		if !slices.Contains(decision.Owners, owner.namespace) {
+			decision.Owners = append(decision.Owners, owner.namespace)
 		}
 	}
 
-	// if allowed is "true", it's because the namespace and vlan are not bound and are considered unrestricted
-	if allowed {
-		l.Debug(fmt.Sprintf("namespace '%s' and vlan '%d' are unrestricted", namespace, vlan))
-		return true
+	// if a vlan is bound, then its namespace must be bound to it
+	if len(decision.Owners) > 0 {
+		decision.Reason = VLANReasonReserved
+		l.Debug(decision.String())
+		return decision
+	}
+
+	// if a namespace is bound, then its vlan must be bound to it
+	if s.index().isNamespaceBound(namespace) {
+		decision.Reason = VLANReasonNamespaceBound
+		decision.NamespaceVLANs = s.namespaceVLANs(namespace)
+		l.Debug(decision.String())
+		return decision
+	}
+
+	// the namespace and vlan are not bound and are considered unrestricted
+	decision.Allowed = true
+	decision.Reason = VLANReasonUnrestricted
+	l.Debug(decision.String())
+	return decision
+}
+
+// index returns the VLAN index, and builds it from the bindings on the first lookup.
+func (s *Settings) index() *vlanIndex {
+	if s.vlans == nil {
+		s.vlans = newVLANIndex(s.NamespaceVLANBindings)
+	}
+
+	return s.vlans
+}
+
+// namespaceVLANs returns the VLANs bound to a namespace, with their cluster network.
+func (s *Settings) namespaceVLANs(namespace string) []string {
+	vlans := []string{}
+	for i, binding := range s.NamespaceVLANBindings {
+		if binding.Namespace != namespace {
+			continue
+		}
+
+		ranges, _ := bindingRanges(i, &binding)
+		for _, vlanRange := range ranges {
+			if binding.ClusterNetwork == "" {
+				vlans = append(vlans, vlanRange.name())
+			} else {
+				vlans = append(vlans, fmt.Sprintf("%s on %s", vlanRange.name(), binding.ClusterNetwork))
+			}
+		}
 	}
 
-	l.Debug(fmt.Sprintf("namespace `%s` or vlan '%d' are restricted and not bound together", namespace, vlan))
-	return false
+	return vlans
+}
+
+// IsVLANTrunkAllowed verifies if a namespace can create networks with a VLAN trunk.
+// The VLANs of an allowed trunk must still be allowed one by one.
+func (s *Settings) IsVLANTrunkAllowed(namespace string) bool {
+	return !slices.Contains(s.VLANTrunkDeniedNamespaces, namespace)
+}
+
+// IsCNITypeAllowed verifies if a namespace can use a CNI plugin type.
+// A namespace without CNI types can use any type.
+func (s *Settings) IsCNITypeAllowed(ctx context.Context, namespace, cniType string) bool {
+	for _, cniTypes := range s.NamespaceCNITypes {
+		if cniTypes.Namespace != namespace {
+			continue
+		}
+
+		allowed := slices.Contains(cniTypes.Types, cniType)
+		logger.FromContext(ctx).DebugWithFields("cni type checked", func(e onelog.Entry) {
+			e.String("Namespace", namespace)
+			e.String("Type", cniType)
+			e.Bool("Allowed", allowed)
+		})
+		return allowed
+	}
+
+	return true
+}
+
+// IsSubnetAllowed verifies if a namespace can use an IPAM subnet.
+// A namespace with subnet bindings can only use subnets inside them, the other namespaces can use any subnet.
+func (s *Settings) IsSubnetAllowed(ctx context.Context, namespace string, subnet netip.Prefix) bool {
+	for _, binding := range s.NamespaceSubnetBindings {
+		if binding.Namespace != namespace {
+			continue
+		}
+
+		allowed := slices.ContainsFunc(binding.Subnets, func(value string) bool {
+			// invalid subnets are rejected with the settings
+			prefix, err := netip.ParsePrefix(value)
+			return err == nil && containsSubnet(prefix.Masked(), subnet)
+		})
+		logger.FromContext(ctx).DebugWithFields("subnet checked", func(e onelog.Entry) {
+			e.String("Namespace", namespace)
+			e.String("Subnet", subnet.String())
+			e.Bool("Allowed", allowed)
+		})
+		return allowed
+	}
+
+	return true
 }
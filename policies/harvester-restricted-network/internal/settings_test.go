@@ -2,14 +2,16 @@ package internal
 
 import (
 	"context"
+	"encoding/json"
+	"net/netip"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestValid(t *testing.T) {
-	ctx := context.Background()
-
 	tests := []struct {
 		name        string
 		settings    Settings
@@ -61,13 +63,610 @@ func TestValid(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := tt.settings.IsValid(ctx)
+			err := tt.settings.Validate()
 
+			assert.Equal(t, tt.result, err == nil)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		problems []string
+	}{
+		{
+			name: "Valid settings",
+			settings: Settings{
+				NamespaceVLANBindings: []NamespaceVLANBinding{
+					{Namespace: "namespace1", VLAN: 42},
+					{Namespace: "namespace1", VLAN: 43},
+					{Namespace: "namespace2", VLAN: 42},
+				},
+			},
+		},
+		{
+			name: "Valid settings with VLAN ranges",
+			settings: Settings{
+				NamespaceVLANBindings: []NamespaceVLANBinding{
+					{Namespace: "namespace1", VLANs: []string{"1-99", "310", "4000-4094"}},
+					{Namespace: "namespace1", VLAN: 100},
+					{Namespace: "namespace2", VLANs: []string{"50-60"}},
+					{Namespace: "namespace2", VLANs: []string{"50-60"}, ClusterNetwork: "data"},
+				},
+			},
+		},
+		{
+			name: "Invalid VLAN ranges",
+			settings: Settings{
+				NamespaceVLANBindings: []NamespaceVLANBinding{
+					{Namespace: "namespace1", VLANs: []string{"0-10", "200-4095", "abc", "300-200", "5-"}},
+					{Namespace: "namespace2", VLAN: 4095},
+				},
+			},
+			problems: []string{
+				"namespaceVLANBindings[0].vlans[0]: VLANs 0-10 are out of range 1-4094",
+				"namespaceVLANBindings[0].vlans[1]: VLANs 200-4095 are out of range 1-4094",
+				"namespaceVLANBindings[0].vlans[2]: 'abc' is not a VLAN or a VLAN range",
+				"namespaceVLANBindings[0].vlans[3]: VLANs 300-200 start after they end",
+				"namespaceVLANBindings[0].vlans[4]: '5-' is not a VLAN or a VLAN range",
+				"namespaceVLANBindings[1].vlan: VLANs 4095 are out of range 1-4094",
+			},
+		},
+		{
+			name: "Overlapping VLAN ranges of a namespace",
+			settings: Settings{
+				NamespaceVLANBindings: []NamespaceVLANBinding{
+					{Namespace: "namespace1", VLANs: []string{"200-299", "250"}},
+					{Namespace: "namespace1", VLANs: []string{"290-310"}},
+					{Namespace: "namespace1", VLANs: []string{"200-299"}},
+				},
+			},
+			problems: []string{
+				"namespaceVLANBindings[0]: VLANs 250 overlap VLANs 200-299",
+				"namespaceVLANBindings[1]: VLANs 290-310 overlap VLANs 200-299 of namespaceVLANBindings[0]",
+				"namespaceVLANBindings[2]: duplicate of namespaceVLANBindings[0]",
+			},
+		},
+		{
+			name: "Invalid namespaces denied VLAN trunks",
+			settings: Settings{
+				VLANTrunkDeniedNamespaces: []string{"namespace1", "", "namespace1"},
+			},
+			problems: []string{
+				"vlanTrunkDeniedNamespaces[1]: namespace must be specified",
+				"vlanTrunkDeniedNamespaces[2]: duplicate of vlanTrunkDeniedNamespaces[0]",
+			},
+		},
+		{
+			name: "Invalid namespace CNI types",
+			settings: Settings{
+				NamespaceCNITypes: []NamespaceCNITypes{
+					{Namespace: "namespace1", Types: []string{"bridge"}},
+					{Namespace: "namespace2"},
+					{Namespace: "namespace3", Types: []string{""}},
+					{Namespace: "namespace1", Types: []string{"sriov"}},
+				},
+			},
+			problems: []string{
+				"namespaceCNITypes[1]: namespace and types must be specified",
+				"namespaceCNITypes[2]: namespace and types must be specified",
+				"namespaceCNITypes[3]: duplicate of namespaceCNITypes[0]",
+			},
+		},
+		{
+			name: "Invalid namespace subnet bindings",
+			settings: Settings{
+				NamespaceSubnetBindings: []NamespaceSubnetBinding{
+					{Namespace: "namespace1", Subnets: []string{"10.0.0.0/8", "fd00::/8"}},
+					{Namespace: "namespace2"},
+					{Namespace: "namespace3", Subnets: []string{"10.0.0.0", "fd00::/129"}},
+					{Namespace: "namespace1", Subnets: []string{"192.168.0.0/16"}},
+				},
+			},
+			problems: []string{
+				"namespaceSubnetBindings[1]: namespace and subnets must be specified",
+				"namespaceSubnetBindings[2].subnets[0]: invalid CIDR '10.0.0.0'",
+				"namespaceSubnetBindings[2].subnets[1]: invalid CIDR 'fd00::/129'",
+				"namespaceSubnetBindings[3]: duplicate of namespaceSubnetBindings[0]",
+			},
+		},
+		{
+			name: "Valid untagged and reserved VLANs",
+			settings: Settings{
+				NamespaceVLANBindings: []NamespaceVLANBinding{
+					{Namespace: "namespace1", Untagged: true, ClusterNetwork: "data"},
+					{Namespace: "namespace1", VLAN: 42, Untagged: true},
+					{Namespace: "harvester-system", VLANs: []string{"4000"}},
+				},
+				ReservedVLANs: []ReservedVLANs{
+					{VLANs: []string{"1", "4000-4094"}, Namespaces: []string{"harvester-system"}},
+				},
+			},
+		},
+		{
+			name: "Invalid untagged network reserved for other namespaces",
+			settings: Settings{
+				NamespaceVLANBindings: []NamespaceVLANBinding{
+					{Namespace: "namespace1", Untagged: true, ClusterNetwork: "data"},
+				},
+				ReservedVLANs: []ReservedVLANs{
+					{Untagged: true, Namespaces: []string{"harvester-system"}},
+				},
+			},
+			problems: []string{
+				"namespaceVLANBindings[0]: VLANs untagged overlap reserved VLANs untagged of reservedVLANs[0]",
+			},
+		},
+		{
+			name: "Invalid untagged and reserved VLANs",
+			settings: Settings{
+				NamespaceVLANBindings: []NamespaceVLANBinding{
+					{Namespace: "namespace1", Untagged: true},
+					{Namespace: "namespace1", Untagged: true},
+					{Namespace: "namespace2", VLANs: []string{"3990-4010"}},
+					{Namespace: "namespace3", VLAN: -1},
+				},
+				ReservedVLANs: []ReservedVLANs{
+					{VLANs: []string{"4000-4094"}, Namespaces: []string{"harvester-system"}},
+					{VLANs: []string{"0"}, Namespaces: []string{"harvester-system"}},
+					{VLANs: []string{"1"}},
+				},
+			},
+			problems: []string{
+				"namespaceVLANBindings[1]: duplicate of namespaceVLANBindings[0]",
+				"namespaceVLANBindings[2]: VLANs 3990-4010 overlap reserved VLANs 4000-4094 of reservedVLANs[0]",
+				"namespaceVLANBindings[3].vlan: VLANs -1 are out of range 1-4094",
+				"reservedVLANs[1].vlans[0]: VLANs 0 are out of range 1-4094",
+				"reservedVLANs[2]: vlans or untagged, and namespaces must be specified",
+			},
+		},
+		{
+			name: "Every problem is listed",
+			settings: Settings{
+				NamespaceVLANBindings: []NamespaceVLANBinding{
+					{Namespace: "namespace1", VLAN: 42},
+					{Namespace: "", VLAN: 43},
+					{Namespace: "namespace1", VLAN: 42},
+					{Namespace: "namespace2", VLAN: 0},
+				},
+			},
+			problems: []string{
+				"namespaceVLANBindings[1]: namespace and vlan, vlans or untagged must be specified",
+				"namespaceVLANBindings[2]: duplicate of namespaceVLANBindings[0]",
+				"namespaceVLANBindings[3]: namespace and vlan, vlans or untagged must be specified",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.settings.Validate()
+			if tt.problems == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			var settingsError *SettingsError
+			require.ErrorAs(t, err, &settingsError)
+			assert.Equal(t, tt.problems, settingsError.Problems)
+		})
+	}
+}
+
+func TestNewSettingsFromJSON(t *testing.T) {
+	tests := []struct {
+		name          string
+		payload       string
+		expectedError string
+	}{
+		{
+			name:    "Known fields",
+			payload: `{"namespaceVLANBindings": [{"namespace": "namespace1", "vlan": 42}]}`,
+		},
+		{
+			name:    "VLAN ranges",
+			payload: `{"namespaceVLANBindings": [{"namespace": "namespace1", "vlans": ["200-299", "310"]}]}`,
+		},
+		{
+			name:          "Unknown field",
+			payload:       `{"namespaceVLANBinding": [{"namespace": "namespace1", "vlan": 42}]}`,
+			expectedError: `json: unknown field "namespaceVLANBinding"`,
+		},
+		{
+			name:          "Unknown binding field",
+			payload:       `{"namespaceVLANBindings": [{"namespace": "namespace1", "vlanID": 42}]}`,
+			expectedError: `json: unknown field "vlanID"`,
+		},
+		{
+			name:          "Trailing data",
+			payload:       `{"namespaceVLANBindings": []} {}`,
+			expectedError: "unexpected data after the JSON object",
+		},
+		{
+			name:          "Trailing delimiter",
+			payload:       `{"namespaceVLANBindings": []}}`,
+			expectedError: "unexpected data after the JSON object",
+		},
+		{
+			name:    "Trailing whitespace",
+			payload: "{\"namespaceVLANBindings\": []}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSettingsFromJSON([]byte(tt.payload))
+			if tt.expectedError == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestParseVLANRange(t *testing.T) {
+	tests := []struct {
+		value         string
+		vlanRange     VLANRange
+		expectedError string
+	}{
+		{value: "310", vlanRange: VLANRange{Start: 310, End: 310}},
+		{value: "200-299", vlanRange: VLANRange{Start: 200, End: 299}},
+		{value: " 200 - 299 ", vlanRange: VLANRange{Start: 200, End: 299}},
+		{value: "1-4094", vlanRange: VLANRange{Start: 1, End: 4094}},
+		{value: "", expectedError: "'' is not a VLAN or a VLAN range"},
+		{value: "-5", expectedError: "'-5' is not a VLAN or a VLAN range"},
+		{value: "1-2-3", expectedError: "'1-2-3' is not a VLAN or a VLAN range"},
+		{value: "0", expectedError: "VLANs 0 are out of range 1-4094"},
+		{value: "299-200", expectedError: "VLANs 299-200 start after they end"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			vlanRange, err := ParseVLANRange(tt.value)
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.vlanRange, vlanRange)
+		})
+	}
+}
+
+func TestIsVLANAllowedWithRanges(t *testing.T) {
+	settings := Settings{
+		NamespaceVLANBindings: []NamespaceVLANBinding{
+			{Namespace: "test-restricted-namespace-1", VLANs: []string{"200-299", "310"}},
+			{Namespace: "test-restricted-namespace-2", VLANs: []string{"250-300"}},
+			{Namespace: "test-restricted-namespace-3", VLAN: 42},
+		},
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		namespace string
+		vlan      int
+		result    bool
+	}{
+		{name: "first VLAN of a range", namespace: "test-restricted-namespace-1", vlan: 200, result: true},
+		{name: "last VLAN of a range", namespace: "test-restricted-namespace-1", vlan: 299, result: true},
+		{name: "single VLAN", namespace: "test-restricted-namespace-1", vlan: 310, result: true},
+		{name: "VLAN shared by two namespaces", namespace: "test-restricted-namespace-2", vlan: 260, result: true},
+		{name: "VLAN shared by two namespaces", namespace: "test-restricted-namespace-1", vlan: 260, result: true},
+		{name: "VLAN between ranges", namespace: "test-restricted-namespace-1", vlan: 305, result: false},
+		{name: "VLAN of another namespace", namespace: "test-restricted-namespace-1", vlan: 300, result: false},
+		{name: "VLAN below the ranges", namespace: "test-restricted-namespace-1", vlan: 199, result: false},
+		{name: "unbound namespace with a bound VLAN", namespace: "random-namespace", vlan: 250, result: false},
+		{name: "unbound namespace with a bound VLAN", namespace: "random-namespace", vlan: 42, result: false},
+		{name: "unbound namespace with an unbound VLAN", namespace: "random-namespace", vlan: 305, result: true},
+		{name: "unbound namespace with an unbound VLAN", namespace: "random-namespace", vlan: 4094, result: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := settings.IsVLANAllowed(ctx, tt.namespace, "mgmt", tt.vlan).Allowed
 			assert.Equal(t, tt.result, result)
 		})
 	}
 }
 
+func TestIsVLANAllowedWithClusterNetworks(t *testing.T) {
+	settings := Settings{
+		NamespaceVLANBindings: []NamespaceVLANBinding{
+			{Namespace: "test-restricted-namespace-1", VLANs: []string{"200-299"}, ClusterNetwork: "data"},
+			{Namespace: "test-restricted-namespace-2", VLANs: []string{"200-299"}, ClusterNetwork: "mgmt"},
+			{Namespace: "test-restricted-namespace-3", VLAN: 42},
+		},
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name           string
+		namespace      string
+		clusterNetwork string
+		vlan           int
+		result         bool
+	}{
+		{
+			name:           "VLAN on the bound cluster network",
+			namespace:      "test-restricted-namespace-1",
+			clusterNetwork: "data",
+			vlan:           250,
+			result:         true,
+		},
+		{
+			name:           "VLAN on another cluster network",
+			namespace:      "test-restricted-namespace-1",
+			clusterNetwork: "mgmt",
+			vlan:           250,
+			result:         false,
+		},
+		{
+			name:           "VLAN on a cluster network without bindings",
+			namespace:      "test-restricted-namespace-1",
+			clusterNetwork: "storage",
+			vlan:           250,
+			result:         false,
+		},
+		{
+			name:           "VLAN bound on every cluster network",
+			namespace:      "test-restricted-namespace-3",
+			clusterNetwork: "storage",
+			vlan:           42,
+			result:         true,
+		},
+		{
+			name:           "unbound namespace with a VLAN bound on the cluster network",
+			namespace:      "random-namespace",
+			clusterNetwork: "data",
+			vlan:           250,
+			result:         false,
+		},
+		{
+			name:           "unbound namespace with a VLAN bound on another cluster network",
+			namespace:      "random-namespace",
+			clusterNetwork: "storage",
+			vlan:           250,
+			result:         true,
+		},
+		{
+			name:           "unbound namespace with a VLAN bound on every cluster network",
+			namespace:      "random-namespace",
+			clusterNetwork: "storage",
+			vlan:           42,
+			result:         false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := settings.IsVLANAllowed(ctx, tt.namespace, tt.clusterNetwork, tt.vlan).Allowed
+			assert.Equal(t, tt.result, result)
+		})
+	}
+}
+
+func TestIsVLANTrunkAllowed(t *testing.T) {
+	settings := Settings{
+		VLANTrunkDeniedNamespaces: []string{"test-restricted-namespace-1"},
+	}
+
+	assert.False(t, settings.IsVLANTrunkAllowed("test-restricted-namespace-1"))
+	assert.True(t, settings.IsVLANTrunkAllowed("random-namespace"))
+}
+
+func TestIsCNITypeAllowed(t *testing.T) {
+	settings := Settings{
+		NamespaceCNITypes: []NamespaceCNITypes{
+			{Namespace: "test-restricted-namespace-1", Types: []string{"bridge", "tuning"}},
+		},
+	}
+	ctx := context.Background()
+
+	assert.True(t, settings.IsCNITypeAllowed(ctx, "test-restricted-namespace-1", "bridge"))
+	assert.True(t, settings.IsCNITypeAllowed(ctx, "test-restricted-namespace-1", "tuning"))
+	assert.False(t, settings.IsCNITypeAllowed(ctx, "test-restricted-namespace-1", "macvlan"))
+	assert.True(t, settings.IsCNITypeAllowed(ctx, "random-namespace", "macvlan"))
+}
+
+func TestIsSubnetAllowed(t *testing.T) {
+	settings := Settings{
+		NamespaceSubnetBindings: []NamespaceSubnetBinding{
+			{Namespace: "test-restricted-namespace-1", Subnets: []string{"10.10.0.0/16", "fd00:10::/48"}},
+		},
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		namespace string
+		subnet    string
+		result    bool
+	}{
+		{namespace: "test-restricted-namespace-1", subnet: "10.10.0.0/16", result: true},
+		{namespace: "test-restricted-namespace-1", subnet: "10.10.2.0/24", result: true},
+		{namespace: "test-restricted-namespace-1", subnet: "10.0.0.0/8", result: false},
+		{namespace: "test-restricted-namespace-1", subnet: "10.11.0.0/24", result: false},
+		{namespace: "test-restricted-namespace-1", subnet: "fd00:10:0:1::/64", result: true},
+		{namespace: "test-restricted-namespace-1", subnet: "fd00:11::/64", result: false},
+		{namespace: "test-restricted-namespace-1", subnet: "::ffff:10.10.0.0/120", result: false},
+		{namespace: "random-namespace", subnet: "10.0.0.0/8", result: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.namespace+" "+tt.subnet, func(t *testing.T) {
+			result := settings.IsSubnetAllowed(ctx, tt.namespace, netip.MustParsePrefix(tt.subnet))
+			assert.Equal(t, tt.result, result)
+		})
+	}
+}
+
+func TestIsVLANAllowedDecision(t *testing.T) {
+	settings := Settings{
+		NamespaceVLANBindings: []NamespaceVLANBinding{
+			{Namespace: "a", VLANs: []string{"42", "200-299"}},
+			{Namespace: "b", VLAN: 42},
+			{Namespace: "b", VLAN: 1337, ClusterNetwork: "data"},
+		},
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name           string
+		namespace      string
+		vlan           int
+		decision       VLANDecision
+		expectedString string
+	}{
+		{
+			name:      "bound",
+			namespace: "b",
+			vlan:      42,
+			decision: VLANDecision{
+				Allowed: true, Reason: VLANReasonBound, Namespace: "b", ClusterNetwork: "mgmt", VLAN: 42,
+				Owners: []string{"b"}, NamespaceVLANs: []string{},
+			},
+			expectedString: "VLAN 42 is bound to namespace 'b'",
+		},
+		{
+			name:      "unrestricted",
+			namespace: "c",
+			vlan:      100,
+			decision: VLANDecision{
+				Allowed: true, Reason: VLANReasonUnrestricted, Namespace: "c", ClusterNetwork: "mgmt", VLAN: 100,
+				Owners: []string{}, NamespaceVLANs: []string{},
+			},
+			expectedString: "VLAN 100 and namespace 'c' are unrestricted",
+		},
+		{
+			name:      "reserved",
+			namespace: "c",
+			vlan:      42,
+			decision: VLANDecision{
+				Allowed: false, Reason: VLANReasonReserved, Namespace: "c", ClusterNetwork: "mgmt", VLAN: 42,
+				Owners: []string{"a", "b"}, NamespaceVLANs: []string{},
+			},
+			expectedString: "VLAN 42 is reserved for namespaces [a, b]",
+		},
+		{
+			name:      "namespace bound",
+			namespace: "b",
+			vlan:      100,
+			decision: VLANDecision{
+				Allowed: false, Reason: VLANReasonNamespaceBound, Namespace: "b", ClusterNetwork: "mgmt", VLAN: 100,
+				Owners: []string{}, NamespaceVLANs: []string{"42", "1337 on data"},
+			},
+			expectedString: "namespace 'b' is bound to VLANs [42, 1337 on data], not to VLAN 100",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := settings.IsVLANAllowed(ctx, tt.namespace, "mgmt", tt.vlan)
+			assert.Equal(t, tt.decision, decision)
+			assert.Equal(t, tt.expectedString, decision.String())
+		})
+	}
+}
+
+func TestIsVLANAllowedUntaggedAndReserved(t *testing.T) {
+	settings := Settings{
+		NamespaceVLANBindings: []NamespaceVLANBinding{
+			{Namespace: "test-restricted-namespace-1", Untagged: true, ClusterNetwork: "data"},
+			{Namespace: "test-restricted-namespace-2", VLAN: 42},
+		},
+		ReservedVLANs: []ReservedVLANs{
+			{VLANs: []string{"1", "4000-4094"}, Namespaces: []string{"harvester-system"}},
+		},
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name           string
+		namespace      string
+		clusterNetwork string
+		vlan           int
+		result         bool
+		expectedString string
+	}{
+		{
+			name:           "untagged network bound to the namespace",
+			namespace:      "test-restricted-namespace-1",
+			clusterNetwork: "data",
+			vlan:           0,
+			result:         true,
+			expectedString: "VLAN untagged is bound to namespace 'test-restricted-namespace-1'",
+		},
+		{
+			name:           "untagged network bound to another namespace",
+			namespace:      "random-namespace",
+			clusterNetwork: "data",
+			vlan:           0,
+			result:         false,
+			expectedString: "VLAN untagged is reserved for namespaces [test-restricted-namespace-1]",
+		},
+		{
+			name:           "untagged network of a namespace bound to VLANs",
+			namespace:      "test-restricted-namespace-2",
+			clusterNetwork: "mgmt",
+			vlan:           0,
+			result:         false,
+			expectedString: "namespace 'test-restricted-namespace-2' is bound to VLANs [42], not to VLAN untagged",
+		},
+		{
+			name:           "unbound untagged network",
+			namespace:      "random-namespace",
+			clusterNetwork: "mgmt",
+			vlan:           0,
+			result:         true,
+			expectedString: "VLAN untagged and namespace 'random-namespace' are unrestricted",
+		},
+		{
+			name:           "reserved VLAN of a system namespace",
+			namespace:      "harvester-system",
+			clusterNetwork: "mgmt",
+			vlan:           4001,
+			result:         true,
+			expectedString: "VLAN 4001 is reserved for system namespaces [harvester-system]",
+		},
+		{
+			name:           "reserved VLAN of another namespace",
+			namespace:      "random-namespace",
+			clusterNetwork: "mgmt",
+			vlan:           1,
+			result:         false,
+			expectedString: "VLAN 1 is reserved for system namespaces [harvester-system]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := settings.IsVLANAllowed(ctx, tt.namespace, tt.clusterNetwork, tt.vlan)
+			assert.Equal(t, tt.result, decision.Allowed)
+			assert.Equal(t, tt.expectedString, decision.String())
+		})
+	}
+}
+
+func TestIsVLANAllowedReservedUntagged(t *testing.T) {
+	settings := Settings{
+		ReservedVLANs: []ReservedVLANs{
+			{Untagged: true, Namespaces: []string{"harvester-system"}},
+		},
+	}
+	ctx := context.Background()
+
+	decision := settings.IsVLANAllowed(ctx, "harvester-system", "mgmt", 0)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, "VLAN untagged is reserved for system namespaces [harvester-system]", decision.String())
+
+	decision = settings.IsVLANAllowed(ctx, "random-namespace", "mgmt", 0)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "VLAN untagged is reserved for system namespaces [harvester-system]", decision.String())
+
+	decision = settings.IsVLANAllowed(ctx, "random-namespace", "mgmt", 42)
+	assert.True(t, decision.Allowed)
+}
+
 func TestIsNetworkAllowed(t *testing.T) {
 	settings := Settings{
 		NamespaceVLANBindings: []NamespaceVLANBinding{
@@ -123,8 +722,40 @@ func TestIsNetworkAllowed(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := settings.IsVLANAllowed(ctx, tt.namespace, tt.vlan)
+			result := settings.IsVLANAllowed(ctx, tt.namespace, "mgmt", tt.vlan).Allowed
 			assert.Equal(t, tt.result, result)
 		})
 	}
 }
+
+// sharedVLANBindingCase is a case of the settings that harvester-restricted-network-vm checks too.
+type sharedVLANBindingCase struct {
+	Name     string          `json:"name"`
+	Settings json.RawMessage `json:"settings"`
+	Problems []string        `json:"problems"`
+}
+
+func TestSharedVLANBindings(t *testing.T) {
+	data, err := os.ReadFile("../../harvester-restricted-network-vm/test_data/vlan_bindings.json")
+	require.NoError(t, err)
+
+	cases := []sharedVLANBindingCase{}
+	require.NoError(t, json.Unmarshal(data, &cases))
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			settings, err := NewSettingsFromJSON(tc.Settings)
+			require.NoError(t, err)
+
+			err = settings.Validate()
+			if len(tc.Problems) == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			var settingsError *SettingsError
+			require.ErrorAs(t, err, &settingsError)
+			assert.Equal(t, tc.Problems, settingsError.Problems)
+		})
+	}
+}
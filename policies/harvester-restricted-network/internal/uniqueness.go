@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+)
+
+const (
+	networkAttachmentDefinitionAPIVersion = "k8s.cni.cncf.io/v1"
+	networkAttachmentDefinitionKind       = "NetworkAttachmentDefinition"
+)
+
+// networkAttachmentDefinitionList is the list returned by the kubernetes capability.
+// Its items are decoded one by one, so that a single broken NetworkAttachmentDefinition doesn't hide the others.
+type networkAttachmentDefinitionList struct {
+	Items []json.RawMessage `json:"items"`
+}
+
+// NetworkConflict is a network that a NetworkAttachmentDefinition of another namespace already uses.
+type NetworkConflict struct {
+	Network   Network
+	Namespace string
+	Name      string
+}
+
+func (c NetworkConflict) String() string {
+	return fmt.Sprintf("VLAN %s on cluster network '%s' is already used by NetworkAttachmentDefinition '%s/%s'",
+		vlanName(c.Network.VLAN), c.Network.ClusterNetwork, c.Namespace, c.Name)
+}
+
+// FindNetworkConflict lists every NetworkAttachmentDefinition of the cluster, and returns the first one of another
+// namespace that uses one of the networks, on the same cluster network and VLAN, and whether there is one.
+//
+// Two namespaces can only share a network when both are bound to its VLAN on that cluster network.
+// The untagged network of a cluster network is shared by every namespace, so it never conflicts.
+// NetworkAttachmentDefinitions that cannot be decoded are skipped.
+func (s *Settings) FindNetworkConflict(
+	host *capabilities.Host,
+	namespace string,
+	networks []Network,
+) (NetworkConflict, bool, error) {
+	networks = slices.DeleteFunc(slices.Clone(networks), func(network Network) bool {
+		return network.VLAN == untaggedVLAN
+	})
+	if len(networks) == 0 {
+		return NetworkConflict{}, false, nil
+	}
+
+	kubeRequest := kubernetes.ListAllResourcesRequest{
+		APIVersion: networkAttachmentDefinitionAPIVersion,
+		Kind:       networkAttachmentDefinitionKind,
+	}
+
+	response, err := kubernetes.ListResources(host, kubeRequest)
+	if err != nil {
+		return NetworkConflict{}, false, fmt.Errorf("cannot list NetworkAttachmentDefinitions: %w", err)
+	}
+
+	list := networkAttachmentDefinitionList{}
+	err = json.Unmarshal(response, &list)
+	if err != nil {
+		return NetworkConflict{}, false, fmt.Errorf(
+			"cannot unmarshall response into NetworkAttachmentDefinitions: %w", err)
+	}
+
+	for _, item := range list.Items {
+		other := NetworkAttachmentDefinition{}
+		if json.Unmarshal(item, &other) != nil || other.Metadata.Namespace == namespace {
+			continue
+		}
+
+		otherNetworks, err := other.Networks()
+		if err != nil {
+			continue
+		}
+
+		for _, network := range networks {
+			if s.usesNetwork(otherNetworks, network) &&
+				!s.isNetworkShared(namespace, other.Metadata.Namespace, network) {
+				return NetworkConflict{
+					Network:   network,
+					Namespace: other.Metadata.Namespace,
+					Name:      other.Metadata.Name,
+				}, true, nil
+			}
+		}
+	}
+
+	return NetworkConflict{}, false, nil
+}
+
+// usesNetwork checks whether the networks have the same cluster network and VLAN, trunked or not.
+func (s *Settings) usesNetwork(networks []Network, network Network) bool {
+	return slices.ContainsFunc(networks, func(other Network) bool {
+		return other.ClusterNetwork == network.ClusterNetwork && other.VLAN == network.VLAN
+	})
+}
+
+// isNetworkShared checks whether both namespaces are bound to the VLAN on the cluster network.
+func (s *Settings) isNetworkShared(namespace, other string, network Network) bool {
+	bound := []string{}
+	for _, owner := range s.index().lookup(network.VLAN) {
+		if owner.clusterNetwork == "" || owner.clusterNetwork == network.ClusterNetwork {
+			bound = append(bound, owner.namespace)
+		}
+	}
+
+	return slices.Contains(bound, namespace) && slices.Contains(bound, other)
+}
@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nadItem(t *testing.T, namespace, name, config string) json.RawMessage {
+	t.Helper()
+
+	item, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "k8s.cni.cncf.io/v1",
+		"kind":       "NetworkAttachmentDefinition",
+		"metadata":   map[string]string{"name": name, "namespace": namespace},
+		"spec":       map[string]string{"config": config},
+	})
+	require.NoError(t, err)
+
+	return item
+}
+
+func TestFindNetworkConflict(t *testing.T) {
+	expectedInputPayload := `{"api_version":"k8s.cni.cncf.io/v1","kind":"NetworkAttachmentDefinition"}`
+	settings := Settings{
+		NamespaceVLANBindings: []NamespaceVLANBinding{
+			{Namespace: "namespace-1", VLAN: 42},
+			{Namespace: "namespace-2", VLAN: 42},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		namespace     string
+		networks      []Network
+		items         []json.RawMessage
+		responseError error
+		conflict      string
+		expectError   bool
+	}{
+		{
+			name:      "VLAN used in another namespace",
+			namespace: "namespace-1",
+			networks:  []Network{{ClusterNetwork: "mgmt", VLAN: 100}},
+			items: []json.RawMessage{
+				nadItem(t, "namespace-3", "network-3", `{"type":"bridge","bridge":"mgmt-br","vlan":100}`),
+			},
+			conflict: "VLAN 100 on cluster network 'mgmt' is already used by NetworkAttachmentDefinition " +
+				"'namespace-3/network-3'",
+		},
+		{
+			name:      "VLAN used in a trunk of another namespace",
+			namespace: "namespace-1",
+			networks:  []Network{{ClusterNetwork: "mgmt", VLAN: 100}},
+			items: []json.RawMessage{
+				nadItem(t, "namespace-3", "network-3",
+					`{"type":"bridge","bridge":"mgmt-br","vlanTrunk":[{"minID":50,"maxID":150}]}`),
+			},
+			conflict: "VLAN 100 on cluster network 'mgmt' is already used by NetworkAttachmentDefinition " +
+				"'namespace-3/network-3'",
+		},
+		{
+			name:      "VLAN used in the same namespace",
+			namespace: "namespace-3",
+			networks:  []Network{{ClusterNetwork: "mgmt", VLAN: 100}},
+			items: []json.RawMessage{
+				nadItem(t, "namespace-3", "network-3", `{"type":"bridge","bridge":"mgmt-br","vlan":100}`),
+			},
+		},
+		{
+			name:      "VLAN used on another cluster network",
+			namespace: "namespace-1",
+			networks:  []Network{{ClusterNetwork: "data", VLAN: 100}},
+			items: []json.RawMessage{
+				nadItem(t, "namespace-3", "network-3", `{"type":"bridge","bridge":"mgmt-br","vlan":100}`),
+			},
+		},
+		{
+			name:      "VLAN shared by the bindings",
+			namespace: "namespace-1",
+			networks:  []Network{{ClusterNetwork: "mgmt", VLAN: 42}},
+			items: []json.RawMessage{
+				nadItem(t, "namespace-2", "network-2", `{"type":"bridge","bridge":"mgmt-br","vlan":42}`),
+			},
+		},
+		{
+			name:      "untagged network used in another namespace",
+			namespace: "namespace-1",
+			networks:  []Network{{ClusterNetwork: "mgmt", VLAN: 0}, {ClusterNetwork: "mgmt", VLAN: 100}},
+			items: []json.RawMessage{
+				nadItem(t, "namespace-3", "network-3", `{"type":"bridge","bridge":"mgmt-br"}`),
+			},
+		},
+		{
+			name:      "broken NetworkAttachmentDefinitions are skipped",
+			namespace: "namespace-1",
+			networks:  []Network{{ClusterNetwork: "mgmt", VLAN: 100}},
+			items: []json.RawMessage{
+				nadItem(t, "namespace-3", "network-3", `{"type":"bridge","vlan":"100"}`),
+				nadItem(t, "namespace-3", "network-4", `{"type":"bridge","vlan":5000}`),
+			},
+		},
+		{
+			name:          "list request failed",
+			namespace:     "namespace-1",
+			networks:      []Network{{ClusterNetwork: "mgmt", VLAN: 100}},
+			responseError: assert.AnError,
+			expectError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := json.Marshal(map[string]interface{}{"items": tt.items})
+			require.NoError(t, err)
+
+			mockWapcClient := &mocks.MockWapcClient{}
+			mockWapcClient.
+				EXPECT().
+				HostCall("kubewarden", "kubernetes", "list_resources_all", []byte(expectedInputPayload)).
+				Return(response, tt.responseError).
+				Times(1)
+
+			host := &capabilities.Host{
+				Client: mockWapcClient,
+			}
+
+			conflict, found, err := settings.FindNetworkConflict(host, tt.namespace, tt.networks)
+			if tt.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			if tt.conflict == "" {
+				assert.False(t, found)
+				return
+			}
+			require.True(t, found)
+			assert.Equal(t, tt.conflict, conflict.String())
+		})
+	}
+}
+
+func TestFindNetworkConflictUntagged(t *testing.T) {
+	// the untagged network alone isn't looked up
+	host := &capabilities.Host{
+		Client: &mocks.MockWapcClient{},
+	}
+	settings := Settings{}
+
+	_, found, err := settings.FindNetworkConflict(host, "namespace-1", []Network{{ClusterNetwork: "mgmt", VLAN: 0}})
+	require.NoError(t, err)
+	assert.False(t, found)
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+)
+
+const (
+	virtualMachineAPIVersion = "kubevirt.io/v1"
+	virtualMachineKind       = "VirtualMachine"
+)
+
+type Multus struct {
+	// NetworkName is "namespace/name", or "name" for the namespace of the VirtualMachine.
+	NetworkName string `json:"networkName"`
+}
+
+type VirtualMachineNetwork struct {
+	Multus *Multus `json:"multus"`
+}
+
+type VirtualMachineNetworks struct {
+	Networks []VirtualMachineNetwork `json:"networks"`
+}
+
+type VirtualMachineTemplate struct {
+	Spec VirtualMachineNetworks `json:"spec"`
+}
+
+type VirtualMachineSpec struct {
+	Template VirtualMachineTemplate `json:"template"`
+}
+
+// VirtualMachine is the part of a KubeVirt VirtualMachine that references NetworkAttachmentDefinitions.
+type VirtualMachine struct {
+	Metadata Metadata           `json:"metadata"`
+	Spec     VirtualMachineSpec `json:"spec"`
+}
+
+// UsesNetworkAttachmentDefinition checks whether a multus network of the VirtualMachine is the
+// NetworkAttachmentDefinition.
+func (v *VirtualMachine) UsesNetworkAttachmentDefinition(namespace, name string) bool {
+	return slices.ContainsFunc(v.Spec.Template.Spec.Networks, func(network VirtualMachineNetwork) bool {
+		if network.Multus == nil {
+			return false
+		}
+
+		networkNamespace, networkName, found := strings.Cut(network.Multus.NetworkName, "/")
+		if !found {
+			networkNamespace, networkName = v.Metadata.Namespace, network.Multus.NetworkName
+		}
+
+		return networkNamespace == namespace && networkName == name
+	})
+}
+
+type virtualMachineList struct {
+	Items []json.RawMessage `json:"items"`
+}
+
+// FindNetworkUsers lists every VirtualMachine of the cluster, and returns the "namespace/name" of those that use
+// the NetworkAttachmentDefinition, in any namespace.
+// VirtualMachines that cannot be decoded are skipped.
+func FindNetworkUsers(host *capabilities.Host, namespace, name string) ([]string, error) {
+	kubeRequest := kubernetes.ListAllResourcesRequest{
+		APIVersion: virtualMachineAPIVersion,
+		Kind:       virtualMachineKind,
+	}
+
+	response, err := kubernetes.ListResources(host, kubeRequest)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list VirtualMachines: %w", err)
+	}
+
+	list := virtualMachineList{}
+	err = json.Unmarshal(response, &list)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshall response into VirtualMachines: %w", err)
+	}
+
+	users := []string{}
+	for _, item := range list.Items {
+		virtualMachine := VirtualMachine{}
+		if json.Unmarshal(item, &virtualMachine) != nil {
+			continue
+		}
+
+		if virtualMachine.UsesNetworkAttachmentDefinition(namespace, name) {
+			users = append(users, virtualMachine.Metadata.Namespace+"/"+virtualMachine.Metadata.Name)
+		}
+	}
+	slices.Sort(users)
+
+	return users, nil
+}
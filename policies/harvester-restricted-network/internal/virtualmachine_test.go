@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func virtualMachineItem(t *testing.T, namespace, name string, networkNames ...string) json.RawMessage {
+	t.Helper()
+
+	networks := []map[string]interface{}{{"name": "default", "pod": map[string]string{}}}
+	for _, networkName := range networkNames {
+		networks = append(networks, map[string]interface{}{
+			"name":   "nic-" + networkName,
+			"multus": map[string]string{"networkName": networkName},
+		})
+	}
+
+	item, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "kubevirt.io/v1",
+		"kind":       "VirtualMachine",
+		"metadata":   map[string]string{"name": name, "namespace": namespace},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{"spec": map[string]interface{}{"networks": networks}},
+		},
+	})
+	require.NoError(t, err)
+
+	return item
+}
+
+func TestUsesNetworkAttachmentDefinition(t *testing.T) {
+	tests := []struct {
+		name        string
+		networkName string
+		uses        bool
+	}{
+		{name: "same namespace", networkName: "network-1", uses: true},
+		{name: "namespace and name", networkName: "namespace-1/network-1", uses: true},
+		{name: "other name", networkName: "network-2", uses: false},
+		{name: "other namespace", networkName: "namespace-2/network-1", uses: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			virtualMachine := VirtualMachine{}
+			require.NoError(t, json.Unmarshal(virtualMachineItem(t, "namespace-1", "vm-1", tt.networkName), &virtualMachine))
+
+			assert.Equal(t, tt.uses, virtualMachine.UsesNetworkAttachmentDefinition("namespace-1", "network-1"))
+		})
+	}
+}
+
+func TestFindNetworkUsers(t *testing.T) {
+	expectedInputPayload := `{"api_version":"kubevirt.io/v1","kind":"VirtualMachine"}`
+
+	tests := []struct {
+		name          string
+		items         []json.RawMessage
+		responseError error
+		users         []string
+		expectError   bool
+	}{
+		{
+			name: "no VirtualMachines use the network",
+			items: []json.RawMessage{
+				virtualMachineItem(t, "namespace-1", "vm-1"),
+				virtualMachineItem(t, "namespace-2", "vm-2", "network-1"),
+			},
+			users: []string{},
+		},
+		{
+			name: "VirtualMachines of several namespaces use the network",
+			items: []json.RawMessage{
+				virtualMachineItem(t, "namespace-2", "vm-2", "namespace-1/network-1"),
+				virtualMachineItem(t, "namespace-1", "vm-1", "network-2", "network-1"),
+				json.RawMessage(`{"metadata":"broken"}`),
+			},
+			users: []string{"namespace-1/vm-1", "namespace-2/vm-2"},
+		},
+		{
+			name:          "list request failed",
+			responseError: assert.AnError,
+			expectError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := json.Marshal(map[string]interface{}{"items": tt.items})
+			require.NoError(t, err)
+
+			mockWapcClient := &mocks.MockWapcClient{}
+			mockWapcClient.
+				EXPECT().
+				HostCall("kubewarden", "kubernetes", "list_resources_all", []byte(expectedInputPayload)).
+				Return(response, tt.responseError).
+				Times(1)
+
+			host := &capabilities.Host{
+				Client: mockWapcClient,
+			}
+
+			users, err := FindNetworkUsers(host, "namespace-1", "network-1")
+			if tt.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.users, users)
+		})
+	}
+}
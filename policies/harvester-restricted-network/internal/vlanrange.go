@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	minVLAN = 1
+	maxVLAN = 4094
+	// untaggedVLAN is the VLAN of an untagged network, which is never a valid VLAN ID.
+	untaggedVLAN = 0
+)
+
+// VLANRange is an inclusive range of VLAN IDs, a single VLAN has the same start and end.
+type VLANRange struct {
+	Start int
+	End   int
+}
+
+// ParseVLANRange parses a VLAN, e.g. "310", or a VLAN range, e.g. "200-299".
+func ParseVLANRange(value string) (VLANRange, error) {
+	startValue, endValue, isRange := strings.Cut(strings.TrimSpace(value), "-")
+	if !isRange {
+		endValue = startValue
+	}
+
+	start, err := strconv.Atoi(strings.TrimSpace(startValue))
+	if err != nil {
+		return VLANRange{}, fmt.Errorf("'%s' is not a VLAN or a VLAN range", value)
+	}
+
+	end, err := strconv.Atoi(strings.TrimSpace(endValue))
+	if err != nil {
+		return VLANRange{}, fmt.Errorf("'%s' is not a VLAN or a VLAN range", value)
+	}
+
+	vlanRange := VLANRange{Start: start, End: end}
+	return vlanRange, vlanRange.validate()
+}
+
+func (r VLANRange) validate() error {
+	if !isVLAN(r.Start) || !isVLAN(r.End) {
+		return fmt.Errorf("VLANs %s are out of range %d-%d", r, minVLAN, maxVLAN)
+	}
+
+	if r.Start > r.End {
+		return fmt.Errorf("VLANs %s start after they end", r)
+	}
+
+	return nil
+}
+
+func isVLAN(vlan int) bool {
+	return vlan >= minVLAN && vlan <= maxVLAN
+}
+
+func (r VLANRange) String() string {
+	if r.Start == r.End {
+		return strconv.Itoa(r.Start)
+	}
+
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// vlanName returns the ID of a VLAN, or "untagged" for the untagged network.
+func vlanName(vlan int) string {
+	if vlan == untaggedVLAN {
+		return "untagged"
+	}
+
+	return strconv.Itoa(vlan)
+}
+
+// name is like String, but says "untagged" for the untagged network.
+func (r VLANRange) name() string {
+	if r.Start == untaggedVLAN && r.End == untaggedVLAN {
+		return vlanName(untaggedVLAN)
+	}
+
+	return r.String()
+}
+
+func (r VLANRange) overlaps(other VLANRange) bool {
+	return r.Start <= other.End && other.Start <= r.End
+}
+
+// vlanOwner is a namespace that a VLAN is bound to, on a cluster network or on any of them when empty.
+type vlanOwner struct {
+	namespace      string
+	clusterNetwork string
+}
+
+// vlanSegment is a run of VLANs that are bound to the same owners.
+type vlanSegment struct {
+	start  int
+	end    int
+	owners []vlanOwner
+}
+
+// vlanIndex finds the owners of a VLAN with a binary search.
+//
+// Ranges of different namespaces can overlap, so they are split into segments that don't overlap,
+// each with every owner bound to it.
+type vlanIndex struct {
+	segments   []vlanSegment
+	namespaces map[string]struct{}
+}
+
+type ownedVLANRange struct {
+	owner     vlanOwner
+	vlanRange VLANRange
+}
+
+func newVLANIndex(bindings []NamespaceVLANBinding) *vlanIndex {
+	index := &vlanIndex{namespaces: map[string]struct{}{}}
+
+	ranges := []ownedVLANRange{}
+	boundaries := []int{}
+	for i, binding := range bindings {
+		index.namespaces[binding.Namespace] = struct{}{}
+
+		// invalid ranges are rejected with the settings
+		vlanRanges, _ := bindingRanges(i, &binding)
+		for _, vlanRange := range vlanRanges {
+			ranges = append(ranges, ownedVLANRange{owner: binding.owner(), vlanRange: vlanRange})
+			boundaries = append(boundaries, vlanRange.Start, vlanRange.End+1)
+		}
+	}
+
+	slices.Sort(boundaries)
+	boundaries = slices.Compact(boundaries)
+
+	for i := 0; i+1 < len(boundaries); i++ {
+		segment := vlanSegment{start: boundaries[i], end: boundaries[i+1] - 1}
+		for _, r := range ranges {
+			if r.vlanRange.overlaps(VLANRange{Start: segment.start, End: segment.end}) &&
+				!slices.Contains(segment.owners, r.owner) {
+				segment.owners = append(segment.owners, r.owner)
+			}
+		}
+
+		if len(segment.owners) > 0 {
+			index.segments = append(index.segments, segment)
+		}
+	}
+
+	return index
+}
+
+// lookup returns the owners of a VLAN.
+func (i *vlanIndex) lookup(vlan int) []vlanOwner {
+	position := sort.Search(len(i.segments), func(n int) bool {
+		return i.segments[n].end >= vlan
+	})
+
+	if position == len(i.segments) || i.segments[position].start > vlan {
+		return nil
+	}
+
+	return i.segments[position].owners
+}
+
+func (i *vlanIndex) isNamespaceBound(namespace string) bool {
+	_, ok := i.namespaces[namespace]
+	return ok
+}
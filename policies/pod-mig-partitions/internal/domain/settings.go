@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"bytes"
 	"context"
 
 	kubewardenProtocol "github.com/kubewarden/policy-sdk-go/protocol"
@@ -9,8 +10,20 @@ import (
 // Settings is the structure that describes the policy settings.
 type Settings struct{}
 
-func NewSettingsFromValidationReq(_ *kubewardenProtocol.ValidationRequest) (Settings, error) {
-	return Settings{}, nil
+func NewSettingsFromValidationReq(validationReq *kubewardenProtocol.ValidationRequest) (Settings, error) {
+	return NewSettingsFromJSON(validationReq.Settings)
+}
+
+// NewSettingsFromJSON decodes the settings, and rejects the fields it doesn't know about.
+// The policy has no settings, so any field is a mistake, like settings meant for the ClusterAdmissionPolicy.
+func NewSettingsFromJSON(payload []byte) (Settings, error) {
+	settings := Settings{}
+	if len(bytes.TrimSpace(payload)) == 0 {
+		return settings, nil
+	}
+
+	err := decodeStrict(payload, &settings)
+	return settings, err
 }
 
 func (s *Settings) Valid(_ context.Context) bool {
@@ -43,4 +43,12 @@ func TestNewSettingsFromValidationReq(t *testing.T) {
 
 	_, err := NewSettingsFromValidationReq(validationRequest)
 	require.NoError(t, err)
+
+	validationRequest.Settings = []byte(`{"policyServer": "default"}`)
+	_, err = NewSettingsFromValidationReq(validationRequest)
+	require.EqualError(t, err, `json: unknown field "policyServer"`)
+
+	validationRequest.Settings = []byte(`{}}`)
+	_, err = NewSettingsFromValidationReq(validationRequest)
+	require.EqualError(t, err, "unexpected data after the JSON object")
 }
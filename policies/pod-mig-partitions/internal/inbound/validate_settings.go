@@ -2,10 +2,21 @@ package inbound
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/SUSE/openplatform-kubewarden-policies/policies/pod-mig-partitions/internal/domain"
 	kubewarden "github.com/kubewarden/policy-sdk-go"
 )
 
-func ValidateSettings(_ context.Context, _ []byte) ([]byte, error) {
+func ValidateSettings(ctx context.Context, payload []byte) ([]byte, error) {
+	settings, err := domain.NewSettingsFromJSON(payload)
+	if err != nil {
+		return kubewarden.RejectSettings(kubewarden.Message(fmt.Sprintf("Invalid settings JSON: %v", err)))
+	}
+
+	if !settings.Valid(ctx) {
+		return kubewarden.RejectSettings("settings are not valid")
+	}
+
 	return kubewarden.AcceptSettings()
 }
@@ -22,6 +22,21 @@ func TestValidateSettings(t *testing.T) {
 			payload: []byte(`{}`),
 			result:  `{"valid":true}`,
 		},
+		{
+			name:    "Empty settings",
+			payload: []byte(``),
+			result:  `{"valid":true}`,
+		},
+		{
+			name:    "Unknown field",
+			payload: []byte(`{"mutating": false}`),
+			result:  `{"valid":false,"message":"Invalid settings JSON: json: unknown field \"mutating\""}`,
+		},
+		{
+			name:    "Invalid settings json",
+			payload: []byte(`{`),
+			result:  `{"valid":false,"message":"Invalid settings JSON: unexpected EOF"}`,
+		},
 	}
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {